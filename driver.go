@@ -33,11 +33,24 @@ type Driver struct {
 	// That will ensure the pre- and post-transform queries are correct.
 	Whitelist map[string]Transformed
 
+	// Columns optionally describes the db schema.
+	// It maps table names to their column names,
+	// in table order
+	// (e.g. as given by the table's DDL,
+	// or by information_schema.columns ordered by ordinal_position).
+	// A table that a query qualifies with a schema name is looked up as "schema.table".
+	// The TenantIDCol column may be included or omitted.
+	//
+	// This is needed only to transform queries that depend on the order of a table's columns,
+	// such as INSERT without a column list and INSERT ... SELECT *.
+	Columns map[string][]string
+
 	dynamicCache queryCache
 }
 
 // Transformed is the output of the transformer:
 // a transformed query and the number of the positional parameter added for a tenant-ID value.
+// Num is 0 if no tenant-ID parameter was added.
 type Transformed struct {
 	Query string
 	Num   int
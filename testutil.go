@@ -13,14 +13,27 @@ import (
 // TransformTester runs the transformer on each query that is a key in m.
 // They are sorted first for a predictable test ordering.
 // Each query is tested in a separate call to t.Run.
-// The output of each transform is compared against the corresponding value in m.
-// A mismatch produces a call to t.Error.
+// The output of each transform is compared against the corresponding value in m,
+// and so is the number of its tenant ID parameter,
+// which must be 0 for a query to which no tenant ID condition is added.
+// (That is the value a Conn uses for such a query.)
+// A mismatch in either produces a call to t.Error.
 // Other errors produce calls to t.Fatal.
 //
 // Programs using this package should include a unit test
 // that calls this function with the same value for m
 // that is used in the Driver.Whitelist field.
 func TransformTester(t *testing.T, tenantIDCol string, m map[string]Transformed) {
+	DriverTransformTester(t, &Driver{TenantIDCol: tenantIDCol, Whitelist: m})
+}
+
+// DriverTransformTester is like TransformTester
+// but takes its configuration from d,
+// testing the queries in d.Whitelist.
+// Use this when d.Columns is needed to transform some of the queries.
+func DriverTransformTester(t *testing.T, d *Driver) {
+	m := d.Whitelist
+
 	// Test the items of m in the same order every time.
 	var sorted sort.StringSlice
 	for q := range m {
@@ -41,7 +54,7 @@ func TransformTester(t *testing.T, tenantIDCol string, m map[string]Transformed)
 			stmt := tree.Statements[0]
 			xformer := &transformer{
 				Conn: &Conn{
-					driver: &Driver{TenantIDCol: tenantIDCol},
+					driver: &Driver{TenantIDCol: d.TenantIDCol, Columns: d.Columns},
 				},
 				tenantIDNum: 1 + findMaxParam(stmt),
 			}
@@ -52,6 +65,13 @@ func TransformTester(t *testing.T, tenantIDCol string, m map[string]Transformed)
 			if !strings.EqualFold(got, post.Query) {
 				t.Errorf("mismatch\ngot  %s\nwant %s\n%s", got, post.Query, spew.Sdump(tree))
 			}
+			gotNum := xformer.tenantIDNum
+			if !xformer.isTransformed {
+				gotNum = 0
+			}
+			if gotNum != post.Num {
+				t.Errorf("got tenant ID param number %d, want %d", gotNum, post.Num)
+			}
 		})
 	}
 }
@@ -22,18 +22,50 @@ const (
 	hasTenantID
 	isCTE
 	isLeftJoinTable
+	isOuterTable // a table of an enclosing query, visible in a LATERAL subquery
+	isOuterCTE   // a CTE visible in a CTE's own query, until that query names it
+	isSubquery   // the alias of a subquery in the FROM clause
 )
 
+// An environ maps the names of tables in scope to their status.
+// Names are in their SQL form, quoted as needed by safestr.
 type environ map[string]status
 
 func newEnv() environ {
 	return make(map[string]status)
 }
 
+// newSubEnv returns a new environment for a nested query.
+// It contains the CTE names from env, which remain visible in the nested query.
+func newSubEnv(env environ) environ {
+	subEnv := newEnv()
+	for tbl, state := range env {
+		if state == isCTE || state == isOuterCTE {
+			subEnv[tbl] = state
+		}
+	}
+	return subEnv
+}
+
+// newLateralEnv returns a new environment for a LATERAL subquery.
+// In addition to the CTE names from env,
+// it contains the tables from env, which the subquery may refer to.
+// Those get their tenant ID conditions in the enclosing query, not the subquery.
+func newLateralEnv(env environ) environ {
+	subEnv := newSubEnv(env)
+	for tbl, state := range env {
+		if state != isCTE && state != isOuterCTE {
+			subEnv[tbl] = isOuterTable
+		}
+	}
+	return subEnv
+}
+
 type transformer struct {
 	*Conn
-	tenantIDNum   int  // number of the added positional parameter for the tenant ID value
-	isTransformed bool // whether a tenant ID arg was added
+	tenantIDNum   int                 // number of the added positional parameter for the tenant ID value
+	isTransformed bool                // whether a tenant ID arg was added
+	cteColumns    map[string][]string // output columns of data-modifying CTEs, where known, for expanding SELECT *
 }
 
 func (t *transformer) transformTree(tree pg_query.ParsetreeList) (string, error) {
@@ -75,28 +107,33 @@ func (t *transformer) transformInsert(w io.Writer, stmt nodes.InsertStmt, env en
 	if err != nil {
 		return errors.Wrap(err, "transformInsert")
 	}
-	fmt.Fprintf(w, "INSERT INTO %s ", safestr(*stmt.Relation.Relname))
+	fmt.Fprintf(w, "INSERT INTO %s ", qualifiedName(*stmt.Relation))
 	if stmt.Relation.Alias != nil {
 		fmt.Fprintf(w, "AS %s ", safestr(*stmt.Relation.Alias.Aliasname))
-		env[*stmt.Relation.Alias.Aliasname] = needsTenantID
-	} else {
-		env[*stmt.Relation.Relname] = needsTenantID
+	}
+	env[rangeVarName(*stmt.Relation)] = needsTenantID
+	cols, err := t.insertColumns(stmt, env)
+	if err != nil {
+		return errors.Wrap(err, "transformInsert")
 	}
 	fmt.Fprint(w, "(")
-	for _, col := range stmt.Cols.Items {
-		name, ok := col.(nodes.ResTarget)
-		if !ok {
-			return fmt.Errorf("INSERT INTO (...) item is a %T, want ResTarget", col)
-		}
-		fmt.Fprintf(w, "%s, ", safestr(*name.Name))
+	for _, col := range cols {
+		fmt.Fprintf(w, "%s, ", safestr(col))
+	}
+	fmt.Fprintf(w, "%s) ", safestr(t.driver.TenantIDCol))
+	if stmt.SelectStmt == nil {
+		// INSERT ... DEFAULT VALUES
+		// Every column gets its default except the tenant ID.
+		fmt.Fprint(w, "VALUES (")
+		t.addTenantID(w)
+		fmt.Fprint(w, ")")
+		return t.transformInsertTail(w, stmt, env)
 	}
-	fmt.Fprintf(w, "%s) ", t.driver.TenantIDCol)
 	sel, ok := stmt.SelectStmt.(nodes.SelectStmt)
 	if !ok {
 		return fmt.Errorf("INSERT select statement is a %T, want SelectStmt", stmt.SelectStmt)
 	}
-	switch len(sel.ValuesLists) {
-	case 0:
+	if len(sel.ValuesLists) == 0 {
 		// INSERT ... SELECT
 		subEnv := newEnv()
 		for _, cteName := range cteNames {
@@ -106,40 +143,224 @@ func (t *transformer) transformInsert(w io.Writer, stmt nodes.InsertStmt, env en
 		if err != nil {
 			return errors.Wrap(err, "transformInsert")
 		}
-
-	case 1:
+	} else {
 		// INSERT ... VALUES
-		fmt.Fprint(w, "VALUES (")
-		for _, node := range sel.ValuesLists[0] {
-			err := t.transformNode(w, node, env)
-			if err != nil {
-				return errors.Wrap(err, "transformInsert")
+		// Each row gets the tenant ID.
+		fmt.Fprint(w, "VALUES ")
+		for i, row := range sel.ValuesLists {
+			if i > 0 {
+				fmt.Fprint(w, ", ")
 			}
-			fmt.Fprint(w, ", ")
+			fmt.Fprint(w, "(")
+			for _, node := range row {
+				err := t.transformNode(w, node, env)
+				if err != nil {
+					return errors.Wrap(err, "transformInsert")
+				}
+				fmt.Fprint(w, ", ")
+			}
+			t.addTenantID(w)
+			fmt.Fprint(w, ")")
 		}
-		t.addTenantID(w)
-		io.WriteString(w, ")")
+	}
 
-	default:
-		return fmt.Errorf("SELECT statement has %d items in ValuesLists, want 0 or 1", len(sel.ValuesLists))
+	return t.transformInsertTail(w, stmt, env)
+}
+
+// insertColumns returns the names of the columns an INSERT supplies values for.
+// These are given by its column list if it has one.
+// Otherwise they are the table's first N columns,
+// from the schema in Driver.Columns,
+// where N is the number of values in each row.
+func (t *transformer) insertColumns(stmt nodes.InsertStmt, env environ) ([]string, error) {
+	var cols []string
+	for _, col := range stmt.Cols.Items {
+		name, ok := col.(nodes.ResTarget)
+		if !ok {
+			return nil, fmt.Errorf("INSERT INTO (...) item is a %T, want ResTarget", col)
+		}
+		cols = append(cols, *name.Name)
+	}
+	if len(cols) > 0 || stmt.SelectStmt == nil {
+		return cols, nil
+	}
+
+	sel, ok := stmt.SelectStmt.(nodes.SelectStmt)
+	if !ok {
+		return nil, fmt.Errorf("INSERT select statement is a %T, want SelectStmt", stmt.SelectStmt)
+	}
+	var n int
+	if len(sel.ValuesLists) > 0 {
+		n = len(sel.ValuesLists[0])
+	} else {
+		// The leftmost arm of a set operation determines its columns.
+		for sel.Op != nodes.SETOP_NONE && sel.Larg != nil {
+			sel = *sel.Larg
+		}
+		n = len(sel.TargetList.Items)
+		starCols, err := t.starColumns(sel, env)
+		if err != nil {
+			return nil, errors.Wrap(err, "INSERT without a column list")
+		}
+		if starCols != nil {
+			n = len(starCols)
+		}
+	}
+
+	tableCols, err := t.tableColumns(*stmt.Relation)
+	if err != nil {
+		return nil, errors.Wrap(err, "INSERT without a column list")
+	}
+	if n > len(tableCols) {
+		return nil, fmt.Errorf("INSERT has %d values per row but %s has %d columns", n, qualifiedName(*stmt.Relation), len(tableCols))
+	}
+	return tableCols[:n], nil
+}
+
+// starColumns returns the columns that SELECT * (or SELECT t.*) denotes in sel,
+// omitting the tenant ID column,
+// as SQL expressions.
+// It returns nil if sel's target list contains no *.
+// The columns come from Driver.Columns
+// (or from the RETURNING list of a CTE),
+// and only a lone * selecting from a single table is supported.
+func (t *transformer) starColumns(sel nodes.SelectStmt, env environ) ([]string, error) {
+	var (
+		qualifier []string
+		found     bool
+	)
+	for _, item := range sel.TargetList.Items {
+		target, ok := item.(nodes.ResTarget)
+		if !ok {
+			continue
+		}
+		colRef, ok := target.Val.(nodes.ColumnRef)
+		if !ok || len(colRef.Fields.Items) == 0 {
+			continue
+		}
+		fields := colRef.Fields.Items
+		if _, ok := fields[len(fields)-1].(nodes.A_Star); !ok {
+			continue
+		}
+		if len(sel.TargetList.Items) > 1 {
+			return nil, errors.New("cannot expand * alongside other SELECT items")
+		}
+		for _, field := range fields[:len(fields)-1] {
+			s, ok := field.(nodes.String)
+			if !ok {
+				return nil, fmt.Errorf("* qualifier is a %T, want String", field)
+			}
+			qualifier = append(qualifier, safestr(s.Str))
+		}
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+
+	if len(sel.FromClause.Items) != 1 {
+		return nil, fmt.Errorf("cannot expand SELECT * from %d FROM items, want 1", len(sel.FromClause.Items))
+	}
+	rv, ok := sel.FromClause.Items[0].(nodes.RangeVar)
+	if !ok {
+		return nil, fmt.Errorf("cannot expand SELECT * from a %T, want a table", sel.FromClause.Items[0])
+	}
+	prefix := ""
+	if len(qualifier) > 0 {
+		prefix = strings.Join(qualifier, ".")
+		if prefix != rangeVarName(rv) {
+			return nil, fmt.Errorf("cannot expand %s.*: not the table in the FROM clause", prefix)
+		}
+		prefix += "."
+	}
+
+	var cols []string
+	if rv.Schemaname == nil {
+		cols, ok = t.cteColumns[*rv.Relname]
+		if st := env[safestr(*rv.Relname)]; !ok && (st == isCTE || st == isOuterCTE) {
+			// A CTE shadows any table of the same name.
+			return nil, fmt.Errorf("cannot expand SELECT * from CTE %s: its columns are unknown", safestr(*rv.Relname))
+		}
+	}
+	if cols == nil {
+		var err error
+		cols, err = t.tableColumns(rv)
+		if err != nil {
+			return nil, errors.Wrap(err, "expanding SELECT *")
+		}
+	}
+	var result []string
+	for _, col := range cols {
+		result = append(result, prefix+safestr(col))
+	}
+	return result, nil
+}
+
+// tableColumns returns the columns of the given table from Driver.Columns,
+// in order,
+// omitting the tenant ID column.
+func (t *transformer) tableColumns(rv nodes.RangeVar) ([]string, error) {
+	cols, err := t.allTableColumns(rv)
+	if err != nil {
+		return nil, err
 	}
+	var result []string
+	for _, col := range cols {
+		if col != t.driver.TenantIDCol {
+			result = append(result, col)
+		}
+	}
+	return result, nil
+}
+
+// allTableColumns is like tableColumns but includes the tenant ID column.
+func (t *transformer) allTableColumns(rv nodes.RangeVar) ([]string, error) {
+	name := *rv.Relname
+	if rv.Schemaname != nil && *rv.Schemaname != "" {
+		name = *rv.Schemaname + "." + name
+	}
+	cols, ok := t.driver.Columns[name]
+	if !ok {
+		return nil, fmt.Errorf("no columns for table %s in Driver.Columns", name)
+	}
+	return cols, nil
+}
 
+// transformInsertTail emits the ON CONFLICT and RETURNING clauses of an INSERT.
+func (t *transformer) transformInsertTail(w io.Writer, stmt nodes.InsertStmt, env environ) error {
 	if stmt.OnConflictClause != nil && stmt.OnConflictClause.Action != nodes.ONCONFLICT_NONE {
 		fmt.Fprint(w, " ON CONFLICT ")
-		if stmt.OnConflictClause.Infer != nil {
+		if infer := stmt.OnConflictClause.Infer; infer != nil {
+			if infer.Conname != nil {
+				// The tenant ID column can't be added to a named constraint.
+				// The caller must name the columns of the unique index instead,
+				// which must then include the tenant ID column.
+				return fmt.Errorf("ON CONFLICT ON CONSTRAINT %s not supported, use ON CONFLICT (columns) instead", *infer.Conname)
+			}
 			fmt.Fprint(w, "(")
-			for _, node := range stmt.OnConflictClause.Infer.IndexElems.Items {
+			for _, node := range infer.IndexElems.Items {
 				elem, ok := node.(nodes.IndexElem)
 				if !ok {
 					return fmt.Errorf("ON CONFLICT index element is a %T, want IndexElem", node)
 				}
-				err := t.transformIndexElem(w, elem)
+				err := t.transformIndexElem(w, elem, env)
 				if err != nil {
 					return errors.Wrap(err, "transformInsert")
 				}
 				fmt.Fprint(w, ", ")
 			}
-			fmt.Fprintf(w, "%s) ", t.driver.TenantIDCol)
+			fmt.Fprintf(w, "%s) ", safestr(t.driver.TenantIDCol))
+			if infer.WhereClause != nil {
+				// This is the predicate of a partial unique index,
+				// not a filter on rows,
+				// so it gets no tenant ID condition.
+				fmt.Fprint(w, "WHERE ")
+				err := t.transformNode(w, infer.WhereClause, env)
+				if err != nil {
+					return errors.Wrap(err, "transformInsert")
+				}
+				fmt.Fprint(w, " ")
+			}
 		}
 		fmt.Fprint(w, "DO ")
 		switch stmt.OnConflictClause.Action {
@@ -147,7 +368,7 @@ func (t *transformer) transformInsert(w io.Writer, stmt nodes.InsertStmt, env en
 			fmt.Fprint(w, "NOTHING")
 		case nodes.ONCONFLICT_UPDATE:
 			fmt.Fprint(w, "UPDATE SET ")
-			err := commaSeparated(w, stmt.OnConflictClause.TargetList.Items, env, t.transformNode)
+			err := t.transformSetClause(w, stmt.OnConflictClause.TargetList.Items, env)
 			if err != nil {
 				return errors.Wrap(err, "transformInsert")
 			}
@@ -162,7 +383,7 @@ func (t *transformer) transformInsert(w io.Writer, stmt nodes.InsertStmt, env en
 
 	if len(stmt.ReturningList.Items) > 0 {
 		fmt.Fprint(w, " RETURNING ")
-		err := commaSeparated(w, stmt.ReturningList.Items, env, t.transformNode)
+		err := commaSeparated(w, stmt.ReturningList.Items, env, t.transformSelectCol)
 		if err != nil {
 			return errors.Wrap(err, "transformInsert")
 		}
@@ -176,28 +397,42 @@ func (t *transformer) transformSelect(w io.Writer, stmt nodes.SelectStmt, env en
 	if err != nil {
 		return errors.Wrap(err, "transformSelect")
 	}
+	if stmt.Op != nodes.SETOP_NONE {
+		err = t.transformSetOp(w, stmt, env, insertStmt)
+		if err != nil {
+			return errors.Wrap(err, "transformSelect")
+		}
+		return t.transformSelectTail(w, stmt, env)
+	}
 	fmt.Fprint(w, "SELECT ")
 	if len(stmt.DistinctClause.Items) > 0 {
-		return fmt.Errorf("SELECT DISTINCT not implemented")
+		// Plain DISTINCT is represented as a single nil item.
+		if len(stmt.DistinctClause.Items) == 1 && stmt.DistinctClause.Items[0] == nil {
+			fmt.Fprint(w, "DISTINCT ")
+		} else {
+			fmt.Fprint(w, "DISTINCT ON (")
+			err := commaSeparated(w, stmt.DistinctClause.Items, env, t.transformNode)
+			if err != nil {
+				return errors.Wrap(err, "transformSelect")
+			}
+			fmt.Fprint(w, ") ")
+		}
 	}
 	targetItems := stmt.TargetList.Items
 	var star bool
-	if len(targetItems) == 1 {
-		targetItem, ok := targetItems[0].(nodes.ResTarget)
-		if !ok {
-			return fmt.Errorf("SELECT target item is a %T, want ResTarget", targetItem)
-		}
-		if colRef, ok := targetItem.Val.(nodes.ColumnRef); ok {
-			resTargetItems := colRef.Fields.Items
-			if len(resTargetItems) == 1 {
-				if _, ok := resTargetItems[0].(nodes.A_Star); ok {
-					fmt.Fprint(w, "*")
-					if insertStmt != nil {
-						return fmt.Errorf("cannot handle INSERT ... SELECT *")
-					}
-					star = true
-				}
+	if insertStmt != nil {
+		// The tenant ID must be added to the target list,
+		// so a * must be spelled out.
+		cols, err := t.starColumns(stmt, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSelect")
+		}
+		if cols != nil {
+			star = true
+			for _, col := range cols {
+				fmt.Fprintf(w, "%s, ", col)
 			}
+			t.addTenantID(w)
 		}
 	}
 	if !star {
@@ -238,47 +473,372 @@ func (t *transformer) transformSelect(w io.Writer, stmt nodes.SelectStmt, env en
 			return errors.Wrap(err, "transformSelect")
 		}
 	}
+	if len(stmt.WindowClause.Items) > 0 {
+		fmt.Fprint(w, " WINDOW ")
+		err := commaSeparated(w, stmt.WindowClause.Items, env, func(w io.Writer, item nodes.Node, env environ) error {
+			def, ok := item.(nodes.WindowDef)
+			if !ok {
+				return fmt.Errorf("WINDOW clause item is a %T, want WindowDef", item)
+			}
+			if def.Name == nil {
+				return fmt.Errorf("WINDOW clause item has no name")
+			}
+			fmt.Fprintf(w, "%s AS ", safestr(*def.Name))
+			return t.transformWindowDef(w, def, env)
+		})
+		if err != nil {
+			return errors.Wrap(err, "transformSelect")
+		}
+	}
+	return t.transformSelectTail(w, stmt, env)
+}
+
+// transformSelectTail handles the clauses that may follow
+// either a simple SELECT or a compound one (UNION etc.).
+func (t *transformer) transformSelectTail(w io.Writer, stmt nodes.SelectStmt, env environ) error {
 	if len(stmt.SortClause.Items) > 0 {
 		fmt.Fprint(w, " ORDER BY ")
-		err := commaSeparated(w, stmt.SortClause.Items, env, func(w io.Writer, item nodes.Node, env environ) error {
-			sortBy, ok := item.(nodes.SortBy)
+		err := commaSeparated(w, stmt.SortClause.Items, env, t.transformSortBy)
+		if err != nil {
+			return errors.Wrap(err, "transformSelectTail")
+		}
+	}
+	// FETCH FIRST n ROWS ONLY is parsed into LimitCount too,
+	// so it comes out here as the equivalent LIMIT n.
+	// FETCH FIRST ... WITH TIES is not supported:
+	// it is new in Postgres 13,
+	// and the Postgres 10 parser in pg_query_go rejects it
+	// before it gets here.
+	if stmt.LimitCount != nil {
+		fmt.Fprint(w, " LIMIT ")
+		if isNullConst(stmt.LimitCount) {
+			// LIMIT ALL is represented as LIMIT NULL.
+			fmt.Fprint(w, "ALL")
+		} else {
+			err := t.transformNode(w, stmt.LimitCount, env)
+			if err != nil {
+				return errors.Wrap(err, "transformSelectTail")
+			}
+		}
+	}
+	if stmt.LimitOffset != nil {
+		fmt.Fprint(w, " OFFSET ")
+		err := t.transformNode(w, stmt.LimitOffset, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSelectTail")
+		}
+	}
+	for _, item := range stmt.LockingClause.Items {
+		lc, ok := item.(nodes.LockingClause)
+		if !ok {
+			return fmt.Errorf("locking clause is a %T, want LockingClause", item)
+		}
+		err := t.transformLockingClause(w, lc, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSelectTail")
+		}
+	}
+	return nil
+}
+
+func (t *transformer) transformLockingClause(w io.Writer, lc nodes.LockingClause, env environ) error {
+	switch lc.Strength {
+	case nodes.LCS_FORKEYSHARE:
+		fmt.Fprint(w, " FOR KEY SHARE")
+	case nodes.LCS_FORSHARE:
+		fmt.Fprint(w, " FOR SHARE")
+	case nodes.LCS_FORNOKEYUPDATE:
+		fmt.Fprint(w, " FOR NO KEY UPDATE")
+	case nodes.LCS_FORUPDATE:
+		fmt.Fprint(w, " FOR UPDATE")
+	default:
+		return fmt.Errorf("locking clause strength %v not implemented", lc.Strength)
+	}
+	if len(lc.LockedRels.Items) > 0 {
+		fmt.Fprint(w, " OF ")
+		// These name tables (or aliases) already in the FROM clause.
+		// They are not passed to transformNode,
+		// which would add them to env as new tables needing a tenant ID.
+		err := commaSeparated(w, lc.LockedRels.Items, env, func(w io.Writer, node nodes.Node, env environ) error {
+			rv, ok := node.(nodes.RangeVar)
 			if !ok {
-				return fmt.Errorf("SORT BY clause is a %T, want SortBy", item)
+				return fmt.Errorf("locked relation is a %T, want RangeVar", node)
 			}
-			err := t.transformNode(w, sortBy.Node, env)
-			if err != nil {
-				return err
+			if rv.Schemaname != nil {
+				return fmt.Errorf("locked relation %s.%s is qualified, want unqualified", *rv.Schemaname, *rv.Relname)
 			}
-			switch sortBy.SortbyDir {
-			case nodes.SORTBY_ASC:
-				fmt.Fprint(w, " ASC")
-			case nodes.SORTBY_DESC:
-				fmt.Fprint(w, " DESC")
+			name := safestr(*rv.Relname)
+			if !inFromClause(env, name) {
+				return fmt.Errorf("locked relation %s not found in FROM clause", *rv.Relname)
 			}
+			fmt.Fprint(w, name)
 			return nil
 		})
 		if err != nil {
-			return errors.Wrap(err, "transformSelect")
+			return errors.Wrap(err, "transformLockingClause")
 		}
 	}
-	if stmt.LimitCount != nil {
-		fmt.Fprint(w, " LIMIT ")
-		err = t.transformNode(w, stmt.LimitCount, env)
+	switch lc.WaitPolicy {
+	case nodes.LockWaitSkip:
+		fmt.Fprint(w, " SKIP LOCKED")
+	case nodes.LockWaitError:
+		fmt.Fprint(w, " NOWAIT")
+	}
+	return nil
+}
+
+// inFromClause tells whether env contains the table with the given (unqualified) name,
+// either as is or qualified by a schema name,
+// as it may be in a FOR UPDATE OF list.
+func inFromClause(env environ, name string) bool {
+	if env[name] != noStatus {
+		return true
+	}
+	for table := range env {
+		if strings.HasSuffix(table, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *transformer) transformSortBy(w io.Writer, item nodes.Node, env environ) error {
+	sortBy, ok := item.(nodes.SortBy)
+	if !ok {
+		return fmt.Errorf("SORT BY clause is a %T, want SortBy", item)
+	}
+	err := t.transformNode(w, sortBy.Node, env)
+	if err != nil {
+		return err
+	}
+	switch sortBy.SortbyDir {
+	case nodes.SORTBY_ASC:
+		fmt.Fprint(w, " ASC")
+	case nodes.SORTBY_DESC:
+		fmt.Fprint(w, " DESC")
+	case nodes.SORTBY_USING:
+		var names []string
+		for _, item := range sortBy.UseOp.Items {
+			s, ok := item.(nodes.String)
+			if !ok {
+				return fmt.Errorf("ORDER BY ... USING operator name is a %T, want String", item)
+			}
+			names = append(names, s.Str)
+		}
+		switch len(names) {
+		case 0:
+			return errors.New("ORDER BY ... USING has no operator")
+		case 1:
+			fmt.Fprintf(w, " USING %s", names[0])
+		default:
+			// A schema-qualified operator.
+			for i := 0; i < len(names)-1; i++ {
+				names[i] = safestr(names[i])
+			}
+			fmt.Fprintf(w, " USING OPERATOR(%s)", strings.Join(names, "."))
+		}
+	}
+	switch sortBy.SortbyNulls {
+	case nodes.SORTBY_NULLS_FIRST:
+		fmt.Fprint(w, " NULLS FIRST")
+	case nodes.SORTBY_NULLS_LAST:
+		fmt.Fprint(w, " NULLS LAST")
+	}
+	return nil
+}
+
+// Window frame option bits.
+// These mirror the FRAMEOPTION_* values in Postgres's parsenodes.h,
+// which pg_query_go does not export.
+const (
+	frameOptionNonDefault              = 0x00001
+	frameOptionRange                   = 0x00002
+	frameOptionRows                    = 0x00004
+	frameOptionBetween                 = 0x00008
+	frameOptionStartUnboundedPreceding = 0x00010
+	frameOptionEndUnboundedPreceding   = 0x00020
+	frameOptionStartUnboundedFollowing = 0x00040
+	frameOptionEndUnboundedFollowing   = 0x00080
+	frameOptionStartCurrentRow         = 0x00100
+	frameOptionEndCurrentRow           = 0x00200
+	frameOptionStartValuePreceding     = 0x00400
+	frameOptionEndValuePreceding       = 0x00800
+	frameOptionStartValueFollowing     = 0x01000
+	frameOptionEndValueFollowing       = 0x02000
+)
+
+// transformWindowDef emits the parenthesized part of a window specification,
+// as found after OVER or in a WINDOW clause.
+func (t *transformer) transformWindowDef(w io.Writer, def nodes.WindowDef, env environ) error {
+	var parts []string
+
+	if def.Refname != nil {
+		parts = append(parts, safestr(*def.Refname))
+	}
+	if len(def.PartitionClause.Items) > 0 {
+		buf := new(bytes.Buffer)
+		fmt.Fprint(buf, "PARTITION BY ")
+		err := commaSeparated(buf, def.PartitionClause.Items, env, t.transformNode)
 		if err != nil {
-			return errors.Wrap(err, "transformSelect")
+			return errors.Wrap(err, "transformWindowDef")
+		}
+		parts = append(parts, buf.String())
+	}
+	if len(def.OrderClause.Items) > 0 {
+		buf := new(bytes.Buffer)
+		fmt.Fprint(buf, "ORDER BY ")
+		err := commaSeparated(buf, def.OrderClause.Items, env, t.transformSortBy)
+		if err != nil {
+			return errors.Wrap(err, "transformWindowDef")
+		}
+		parts = append(parts, buf.String())
+	}
+	if def.FrameOptions&frameOptionNonDefault != 0 {
+		buf := new(bytes.Buffer)
+		err := t.transformFrame(buf, def, env)
+		if err != nil {
+			return errors.Wrap(err, "transformWindowDef")
+		}
+		parts = append(parts, buf.String())
+	}
+
+	fmt.Fprintf(w, "(%s)", strings.Join(parts, " "))
+	return nil
+}
+
+func (t *transformer) transformFrame(w io.Writer, def nodes.WindowDef, env environ) error {
+	opts := def.FrameOptions
+	switch {
+	case opts&frameOptionRange != 0:
+		fmt.Fprint(w, "RANGE ")
+	case opts&frameOptionRows != 0:
+		fmt.Fprint(w, "ROWS ")
+	default:
+		return fmt.Errorf("window frame options %#x have neither RANGE nor ROWS", opts)
+	}
+	if opts&frameOptionBetween != 0 {
+		fmt.Fprint(w, "BETWEEN ")
+	}
+	switch {
+	case opts&frameOptionStartUnboundedPreceding != 0:
+		fmt.Fprint(w, "UNBOUNDED PRECEDING")
+	case opts&frameOptionStartUnboundedFollowing != 0:
+		fmt.Fprint(w, "UNBOUNDED FOLLOWING")
+	case opts&frameOptionStartCurrentRow != 0:
+		fmt.Fprint(w, "CURRENT ROW")
+	case opts&frameOptionStartValuePreceding != 0:
+		err := t.transformAtom(w, def.StartOffset, env)
+		if err != nil {
+			return errors.Wrap(err, "transformFrame")
+		}
+		fmt.Fprint(w, " PRECEDING")
+	case opts&frameOptionStartValueFollowing != 0:
+		err := t.transformAtom(w, def.StartOffset, env)
+		if err != nil {
+			return errors.Wrap(err, "transformFrame")
+		}
+		fmt.Fprint(w, " FOLLOWING")
+	default:
+		return fmt.Errorf("window frame options %#x have no start bound", opts)
+	}
+	if opts&frameOptionBetween == 0 {
+		// Without BETWEEN, the (implicit) end bound is CURRENT ROW.
+		return nil
+	}
+	fmt.Fprint(w, " AND ")
+	switch {
+	case opts&frameOptionEndUnboundedPreceding != 0:
+		fmt.Fprint(w, "UNBOUNDED PRECEDING")
+	case opts&frameOptionEndUnboundedFollowing != 0:
+		fmt.Fprint(w, "UNBOUNDED FOLLOWING")
+	case opts&frameOptionEndCurrentRow != 0:
+		fmt.Fprint(w, "CURRENT ROW")
+	case opts&frameOptionEndValuePreceding != 0:
+		err := t.transformAtom(w, def.EndOffset, env)
+		if err != nil {
+			return errors.Wrap(err, "transformFrame")
+		}
+		fmt.Fprint(w, " PRECEDING")
+	case opts&frameOptionEndValueFollowing != 0:
+		err := t.transformAtom(w, def.EndOffset, env)
+		if err != nil {
+			return errors.Wrap(err, "transformFrame")
 		}
+		fmt.Fprint(w, " FOLLOWING")
+	default:
+		return fmt.Errorf("window frame options %#x have no end bound", opts)
+	}
+	return nil
+}
+
+// transformSetOp handles UNION, INTERSECT, and EXCEPT.
+// Each arm gets its own environment
+// (seeded with the CTE names visible to the compound statement),
+// and so its own tenant ID predicate.
+func (t *transformer) transformSetOp(w io.Writer, stmt nodes.SelectStmt, env environ, insertStmt *nodes.InsertStmt) error {
+	if stmt.Larg == nil || stmt.Rarg == nil {
+		return fmt.Errorf("set operation is missing an argument")
+	}
+	err := t.transformSetOpArm(w, *stmt.Larg, stmt.Op, true, env, insertStmt)
+	if err != nil {
+		return errors.Wrap(err, "transformSetOp")
+	}
+	switch stmt.Op {
+	case nodes.SETOP_UNION:
+		fmt.Fprint(w, " UNION ")
+	case nodes.SETOP_INTERSECT:
+		fmt.Fprint(w, " INTERSECT ")
+	case nodes.SETOP_EXCEPT:
+		fmt.Fprint(w, " EXCEPT ")
+	default:
+		return fmt.Errorf("set operation %v not implemented", stmt.Op)
+	}
+	if stmt.All {
+		fmt.Fprint(w, "ALL ")
+	}
+	err = t.transformSetOpArm(w, *stmt.Rarg, stmt.Op, false, env, insertStmt)
+	if err != nil {
+		return errors.Wrap(err, "transformSetOp")
+	}
+	return nil
+}
+
+func (t *transformer) transformSetOpArm(w io.Writer, arm nodes.SelectStmt, parentOp nodes.SetOperation, isLeft bool, env environ, insertStmt *nodes.InsertStmt) error {
+	// An arm needs parentheses if it has clauses that would otherwise
+	// attach to the compound statement,
+	// or if it is itself a set operation that would otherwise associate differently.
+	// Set operations are left-associative,
+	// so a left arm with the same operator as its parent needs none.
+	parens := arm.WithClause != nil ||
+		len(arm.SortClause.Items) > 0 ||
+		arm.LimitCount != nil ||
+		arm.LimitOffset != nil ||
+		len(arm.LockingClause.Items) > 0 ||
+		(arm.Op != nodes.SETOP_NONE && !(isLeft && arm.Op == parentOp))
+
+	subEnv := newSubEnv(env)
+
+	if parens {
+		fmt.Fprint(w, "(")
+	}
+	err := t.transformSelect(w, arm, subEnv, insertStmt)
+	if err != nil {
+		return err
+	}
+	if parens {
+		fmt.Fprint(w, ")")
 	}
 	return nil
 }
 
 func (t *transformer) transformWhere(w io.Writer, where nodes.Node, env environ, onConflict bool) error {
-	// If this query involves a LEFT JOIN, the main table that we do the LEFT JOIN on would have
-	// a status "isLeftJoinTable". We will have to add the tenant ID in the where clause so that
-	// the LEFT JOIN won't include other tenants' data.
+	// If this query involves an outer join, the tables on its preserved side
+	// (e.g. the left side of a LEFT JOIN) have the status "isLeftJoinTable".
+	// We will have to add the tenant ID in the where clause so that
+	// the outer join won't include other tenants' data.
 	for tbl, status := range env {
 		if status == isLeftJoinTable {
 			env[tbl] = needsTenantID
-			break
 		}
 	}
 	doWhere := where != nil
@@ -295,8 +855,10 @@ func (t *transformer) transformWhere(w io.Writer, where nodes.Node, env environ,
 	}
 	fmt.Fprint(w, " WHERE ")
 	var tables sort.StringSlice
-	for table := range env {
-		tables = append(tables, table)
+	for table, state := range env {
+		if state != isOuterCTE {
+			tables = append(tables, table)
+		}
 	}
 	tables.Sort()
 	return t.transformWhereHelper(w, where, env, onConflict, tables)
@@ -343,13 +905,37 @@ func (t *transformer) transformWhereHelper(w io.Writer, where nodes.Node, env en
 		if len(tables) > 1 || onConflict {
 			fmt.Fprint(w, table, ".")
 		}
-		fmt.Fprint(w, t.driver.TenantIDCol, " = ")
+		fmt.Fprint(w, safestr(t.driver.TenantIDCol), " = ")
 		t.addTenantID(w)
 		env[table] = hasTenantID
 	}
 	return nil
 }
 
+// qualifiedName returns the name of the table in rv,
+// including its catalog and schema names if present.
+// It does not consider rv's alias.
+// This is also the table's key in an environ,
+// so tables with the same name in different schemas are kept distinct.
+func qualifiedName(rv nodes.RangeVar) string {
+	var parts []string
+	for _, p := range []*string{rv.Catalogname, rv.Schemaname, rv.Relname} {
+		if p != nil && *p != "" {
+			parts = append(parts, safestr(*p))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// rangeVarName returns the name by which the rest of the query refers to the table in rv:
+// its alias if it has one, otherwise its qualified name.
+func rangeVarName(rv nodes.RangeVar) string {
+	if rv.Alias != nil {
+		return safestr(*rv.Alias.Aliasname)
+	}
+	return qualifiedName(rv)
+}
+
 func extractTables(from []nodes.Node) (map[string]bool, error) {
 	m := make(map[string]bool)
 	for _, f := range from {
@@ -361,11 +947,7 @@ func extractTables(from []nodes.Node) (map[string]bool, error) {
 func extractTablesAux(n nodes.Node, out map[string]bool) {
 	switch n := n.(type) {
 	case nodes.RangeVar:
-		if n.Alias != nil {
-			out[*n.Alias.Aliasname] = true
-		} else {
-			out[*n.Relname] = true
-		}
+		out[rangeVarName(n)] = true
 
 	case nodes.JoinExpr:
 		extractTablesAux(n.Larg, out)
@@ -373,7 +955,7 @@ func extractTablesAux(n nodes.Node, out map[string]bool) {
 
 	case nodes.RangeSubselect:
 		if n.Alias != nil && n.Alias.Aliasname != nil && *n.Alias.Aliasname != "" {
-			out[*n.Alias.Aliasname] = true
+			out[safestr(*n.Alias.Aliasname)] = true
 		}
 	}
 }
@@ -389,7 +971,7 @@ func (t *transformer) transformUpdate(w io.Writer, stmt nodes.UpdateStmt, env en
 		return errors.Wrap(err, "transformUpdate")
 	}
 	fmt.Fprint(w, " SET ")
-	err = commaSeparated(w, stmt.TargetList.Items, env, t.transformNode)
+	err = t.transformSetClause(w, stmt.TargetList.Items, env)
 	if err != nil {
 		return errors.Wrap(err, "transformUpdate")
 	}
@@ -400,18 +982,13 @@ func (t *transformer) transformUpdate(w io.Writer, stmt nodes.UpdateStmt, env en
 			return errors.Wrap(err, "transformUpdate")
 		}
 	}
-	if stmt.WhereClause == nil {
-		fmt.Fprintf(w, " WHERE %s = ", t.driver.TenantIDCol)
-		t.addTenantID(w)
-		return nil
-	}
 	err = t.transformWhere(w, stmt.WhereClause, env, false)
 	if err != nil {
 		return errors.Wrap(err, "transformUpdate")
 	}
 	if len(stmt.ReturningList.Items) > 0 {
 		fmt.Fprint(w, " RETURNING ")
-		err = commaSeparated(w, stmt.ReturningList.Items, env, t.transformNode)
+		err = commaSeparated(w, stmt.ReturningList.Items, env, t.transformSelectCol)
 		if err != nil {
 			return errors.Wrap(err, "transformUpdate")
 		}
@@ -419,11 +996,56 @@ func (t *transformer) transformUpdate(w io.Writer, stmt nodes.UpdateStmt, env en
 	return nil
 }
 
-// returns the list of cte aliases
-func (t *transformer) handleCTE(w io.Writer, withClause *nodes.WithClause, env environ) ([]string, error) {
-	if withClause == nil {
-		return nil, nil
-	}
+// transformSetClause emits the assignments of an UPDATE or ON CONFLICT DO UPDATE.
+// A multi-column assignment, SET (a, b) = source,
+// appears as consecutive ResTargets, one per column,
+// each with a MultiAssignRef value pointing to the same source.
+func (t *transformer) transformSetClause(w io.Writer, targets []nodes.Node, env environ) error {
+	for i := 0; i < len(targets); i++ {
+		if i > 0 {
+			fmt.Fprint(w, ", ")
+		}
+		target, ok := targets[i].(nodes.ResTarget)
+		if !ok {
+			return fmt.Errorf("SET item is a %T, want ResTarget", targets[i])
+		}
+		ref, ok := target.Val.(nodes.MultiAssignRef)
+		if !ok {
+			err := t.transformNode(w, target, env)
+			if err != nil {
+				return errors.Wrap(err, "transformSetClause")
+			}
+			continue
+		}
+		if ref.Colno != 1 || i+ref.Ncolumns > len(targets) {
+			return fmt.Errorf("malformed multi-column assignment")
+		}
+		fmt.Fprint(w, "(")
+		for j := 0; j < ref.Ncolumns; j++ {
+			col, ok := targets[i+j].(nodes.ResTarget)
+			if !ok || col.Name == nil {
+				return fmt.Errorf("multi-column assignment item is a %T, want named ResTarget", targets[i+j])
+			}
+			if j > 0 {
+				fmt.Fprint(w, ", ")
+			}
+			fmt.Fprint(w, safestr(*col.Name))
+		}
+		fmt.Fprint(w, ") = ")
+		err := t.transformNode(w, ref.Source, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSetClause")
+		}
+		i += ref.Ncolumns - 1
+	}
+	return nil
+}
+
+// returns the list of cte aliases
+func (t *transformer) handleCTE(w io.Writer, withClause *nodes.WithClause, env environ) ([]string, error) {
+	if withClause == nil {
+		return nil, nil
+	}
 
 	var cteNames []string
 
@@ -441,41 +1063,62 @@ func (t *transformer) handleCTE(w io.Writer, withClause *nodes.WithClause, env e
 		if !ok {
 			return nil, fmt.Errorf("Ctequery item is a %T, want CommonTableExpr", cteItem)
 		}
-		fmt.Fprintf(w, "%s AS (", safestr(*cte.Ctename))
-		env[*cte.Ctename] = isCTE
+		name := safestr(*cte.Ctename)
+		fmt.Fprint(w, name)
+		err := transformColnames(w, cte.Aliascolnames)
+		if err != nil {
+			return nil, errors.Wrap(err, "handleCTE")
+		}
+		fmt.Fprint(w, " AS (")
 
-		cteNames = append(cteNames, *cte.Ctename)
+		// Each CTE may refer to the ones before it,
+		// and a recursive one to itself.
+		// Otherwise its name may denote a real table inside it.
+		// Those names do not count as tables of its query
+		// (e.g. for qualifying the tenant ID column)
+		// until it names them.
+		subEnv := newEnv()
+		for tbl, state := range env {
+			if state == isCTE || state == isOuterCTE {
+				subEnv[tbl] = isOuterCTE
+			}
+		}
+		if withClause.Recursive {
+			subEnv[name] = isOuterCTE
+		}
+		env[name] = isCTE
+
+		cteNames = append(cteNames, name)
 
 		switch substmt := cte.Ctequery.(type) {
 		case nodes.SelectStmt:
-			subEnv := newEnv()
-			err := t.transformSelect(w, substmt, subEnv, nil)
-			if err != nil {
-				return nil, errors.Wrap(err, "handleCTE")
-			}
-			for tbl, state := range subEnv {
-				if state == isCTE {
-					env[tbl] = isCTE
-				}
-			}
+			err = t.transformSelect(w, substmt, subEnv, nil)
 
 		case nodes.InsertStmt:
 			if substmt.SelectStmt == nil {
 				return nil, fmt.Errorf("Ctequery has no SELECT")
 			}
-			subEnv := newEnv()
-			err := t.transformInsert(w, substmt, subEnv)
-			if err != nil {
-				return nil, errors.Wrap(err, "handleCTE")
-			}
-			for tbl, state := range subEnv {
-				if state == isCTE {
-					env[tbl] = isCTE
-				}
-			}
+			err = t.transformInsert(w, substmt, subEnv)
+			t.setCTEColumns(cte, substmt.ReturningList, *substmt.Relation)
+
+		case nodes.UpdateStmt:
+			err = t.transformUpdate(w, substmt, subEnv)
+			t.setCTEColumns(cte, substmt.ReturningList, *substmt.Relation)
+
+		case nodes.DeleteStmt:
+			err = t.transformDelete(w, substmt, subEnv)
+			t.setCTEColumns(cte, substmt.ReturningList, *substmt.Relation)
 
 		default:
-			return nil, fmt.Errorf("Ctequery is a %T, want SELECT or INSERT ... SELECT", cte.Ctequery)
+			return nil, fmt.Errorf("Ctequery is a %T, want SELECT, INSERT, UPDATE, or DELETE", cte.Ctequery)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "handleCTE")
+		}
+		for tbl, state := range subEnv {
+			if state == isCTE {
+				env[tbl] = isCTE
+			}
 		}
 
 		fmt.Fprint(w, ")")
@@ -485,9 +1128,75 @@ func (t *transformer) handleCTE(w io.Writer, withClause *nodes.WithClause, env e
 	return cteNames, nil
 }
 
+// setCTEColumns records the output columns of a data-modifying CTE,
+// as given by its RETURNING list and renamed by its column list if it has one,
+// so that SELECT * from it can be expanded.
+// Nothing is recorded if they can't be determined.
+func (t *transformer) setCTEColumns(cte nodes.CommonTableExpr, returning nodes.List, rv nodes.RangeVar) {
+	var outCols []string
+	for _, item := range returning.Items {
+		target, ok := item.(nodes.ResTarget)
+		if !ok {
+			return
+		}
+		if target.Name != nil {
+			outCols = append(outCols, *target.Name)
+			continue
+		}
+		colRef, ok := target.Val.(nodes.ColumnRef)
+		if !ok || len(colRef.Fields.Items) == 0 {
+			return
+		}
+		switch field := colRef.Fields.Items[len(colRef.Fields.Items)-1].(type) {
+		case nodes.String:
+			outCols = append(outCols, field.Str)
+		case nodes.A_Star:
+			tableCols, err := t.allTableColumns(rv)
+			if err != nil {
+				return
+			}
+			outCols = append(outCols, tableCols...)
+		default:
+			return
+		}
+	}
+
+	// The column list renames the leading output columns.
+	// Those are counted including the tenant ID column,
+	// which is dropped only afterwards.
+	if len(cte.Aliascolnames.Items) > len(outCols) {
+		return
+	}
+	for i, item := range cte.Aliascolnames.Items {
+		name, ok := item.(nodes.String)
+		if !ok {
+			return
+		}
+		outCols[i] = name.Str
+	}
+
+	var cols []string
+	for _, col := range outCols {
+		if col != t.driver.TenantIDCol {
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == 0 {
+		return
+	}
+	if t.cteColumns == nil {
+		t.cteColumns = make(map[string][]string)
+	}
+	t.cteColumns[*cte.Ctename] = cols
+}
+
 func (t *transformer) transformDelete(w io.Writer, stmt nodes.DeleteStmt, env environ) error {
+	_, err := t.handleCTE(w, stmt.WithClause, env)
+	if err != nil {
+		return errors.Wrap(err, "transformDelete")
+	}
 	fmt.Fprint(w, "DELETE FROM ")
-	err := t.transformNode(w, *stmt.Relation, env)
+	err = t.transformNode(w, *stmt.Relation, env)
 	if err != nil {
 		return errors.Wrap(err, "transformDelete")
 	}
@@ -500,7 +1209,18 @@ func (t *transformer) transformDelete(w io.Writer, stmt nodes.DeleteStmt, env en
 		}
 	}
 
-	return t.transformWhere(w, stmt.WhereClause, env, false)
+	err = t.transformWhere(w, stmt.WhereClause, env, false)
+	if err != nil {
+		return errors.Wrap(err, "transformDelete")
+	}
+	if len(stmt.ReturningList.Items) > 0 {
+		fmt.Fprint(w, " RETURNING ")
+		err = commaSeparated(w, stmt.ReturningList.Items, env, t.transformSelectCol)
+		if err != nil {
+			return errors.Wrap(err, "transformDelete")
+		}
+	}
+	return nil
 }
 
 func (t *transformer) transformSelectCol(w io.Writer, node nodes.Node, env environ) error {
@@ -534,6 +1254,24 @@ func (t *transformer) transformAtom(w io.Writer, node nodes.Node, env environ) e
 	return nil
 }
 
+// like transformAtom but leaves column references unparenthesized,
+// since table.column is never ambiguous as an operand
+func (t *transformer) transformOperand(w io.Writer, node nodes.Node, env environ) error {
+	if _, ok := node.(nodes.ColumnRef); ok {
+		return t.transformNode(w, node, env)
+	}
+	return t.transformAtom(w, node, env)
+}
+
+// like transformNode but parenthesizes a predicate (e.g. a IS DISTINCT FROM b),
+// which binds more loosely than the operator it is an operand of
+func (t *transformer) transformOpOperand(w io.Writer, node nodes.Node, env environ) error {
+	if isPredicate(node) {
+		return t.transformAtom(w, node, env)
+	}
+	return t.transformNode(w, node, env)
+}
+
 func (t *transformer) transformNode(w io.Writer, node nodes.Node, env environ) error {
 	_, err := t.transformNodeHelper(w, node, env)
 	return err
@@ -550,17 +1288,29 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 			return false, fmt.Errorf("RangeSubselect with %T subquery not handled", node.Subquery)
 		}
 
+		var subEnv environ
+		if node.Lateral {
+			fmt.Fprint(w, "LATERAL ")
+			subEnv = newLateralEnv(env)
+		} else {
+			subEnv = newSubEnv(env)
+		}
+
 		hasAlias := node.Alias != nil && node.Alias.Aliasname != nil && *node.Alias.Aliasname != ""
 		if hasAlias {
 			fmt.Fprint(w, "(")
 		}
-		err := t.transformSelect(w, subquery, newEnv(), nil)
+		err := t.transformSelect(w, subquery, subEnv, nil)
 		if err != nil {
 			return false, errors.Wrap(err, "transformNode (RangeSubselect)")
 		}
 		if hasAlias {
-			fmt.Fprintf(w, ") AS %s", *node.Alias.Aliasname)
-			env[*node.Alias.Aliasname] = isCTE
+			fmt.Fprintf(w, ") AS %s", safestr(*node.Alias.Aliasname))
+			err = transformColnames(w, node.Alias.Colnames)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (RangeSubselect)")
+			}
+			env[safestr(*node.Alias.Aliasname)] = isSubquery
 		}
 		return false, nil
 
@@ -599,23 +1349,22 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 		if len(node.Fields.Items) == 0 {
 			return false, fmt.Errorf("no fields in ColumnRef node")
 		}
-		err := t.transformNodeSafe(w, node.Fields.Items[0], env)
-		if err != nil {
-			return false, errors.Wrap(err, "transformNode (ColumnRef)")
-		}
-		if len(node.Fields.Items) > 1 {
-			fmt.Fprint(w, ".")
-			if _, ok := node.Fields.Items[1].(nodes.A_Star); ok {
+		// Up to four fields: [[catalog.]schema.]table.column,
+		// where the last may be *.
+		for i, field := range node.Fields.Items {
+			if i > 0 {
+				fmt.Fprint(w, ".")
+			}
+			if _, ok := field.(nodes.A_Star); ok {
 				fmt.Fprint(w, "*")
-				return false, nil
+				continue
 			}
-			err = t.transformNodeSafe(w, node.Fields.Items[1], env)
+			err := t.transformNodeSafe(w, field, env)
 			if err != nil {
 				return false, errors.Wrap(err, "transformNode (ColumnRef)")
 			}
-			return false, nil
 		}
-		return true, nil
+		return len(node.Fields.Items) == 1, nil
 
 	case nodes.String:
 		fmt.Fprint(w, node.Str)
@@ -624,7 +1373,7 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 	case nodes.A_Expr:
 		switch node.Kind {
 		case nodes.AEXPR_OP: // normal operator
-			err := t.transformNode(w, node.Lexpr, env)
+			err := t.transformOpOperand(w, node.Lexpr, env)
 			if err != nil {
 				return false, errors.Wrap(err, "transformNode (A_Expr/OP)")
 			}
@@ -641,7 +1390,7 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 			default:
 				fmt.Fprintf(w, " %s ", op.Str)
 			}
-			err = t.transformNode(w, node.Rexpr, env)
+			err = t.transformOpOperand(w, node.Rexpr, env)
 			if err != nil {
 				return false, errors.Wrap(err, "transformNode (A_Expr/OP)")
 			}
@@ -665,6 +1414,37 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 			}
 			fmt.Fprint(w, ")")
 
+		case nodes.AEXPR_OP_ALL: // scalar op ALL (array)
+			op, err := aExprOp(node)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/OP_ALL)")
+			}
+			err = t.transformNode(w, node.Lexpr, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/OP_ALL)")
+			}
+			fmt.Fprintf(w, " %s ALL(", op)
+			err = t.transformNode(w, node.Rexpr, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/OP_ALL)")
+			}
+			fmt.Fprint(w, ")")
+
+		case nodes.AEXPR_DISTINCT, nodes.AEXPR_NOT_DISTINCT: // IS [NOT] DISTINCT FROM - name must be "="
+			err := t.transformOperand(w, node.Lexpr, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/DISTINCT)")
+			}
+			if node.Kind == nodes.AEXPR_DISTINCT {
+				fmt.Fprint(w, " IS DISTINCT FROM ")
+			} else {
+				fmt.Fprint(w, " IS NOT DISTINCT FROM ")
+			}
+			err = t.transformOperand(w, node.Rexpr, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/DISTINCT)")
+			}
+
 		case nodes.AEXPR_NULLIF: // NULLIF(left, right)
 			fmt.Fprint(w, "NULLIF(")
 			err := t.transformNode(w, node.Lexpr, env)
@@ -678,21 +1458,106 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 			}
 			fmt.Fprint(w, ")")
 
+		case nodes.AEXPR_IN: // [NOT] IN - name must be "=" or "<>"
+			op, err := aExprOp(node)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/IN)")
+			}
+			list, ok := node.Rexpr.(nodes.List)
+			if !ok {
+				return false, fmt.Errorf("right side of IN is a %T, want List", node.Rexpr)
+			}
+			err = t.transformOperand(w, node.Lexpr, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/IN)")
+			}
+			switch op {
+			case "=":
+				fmt.Fprint(w, " IN (")
+			case "<>":
+				fmt.Fprint(w, " NOT IN (")
+			default:
+				return false, fmt.Errorf("operator for IN is %s, want = or <>", op)
+			}
+			err = commaSeparated(w, list.Items, env, t.transformNode)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/IN)")
+			}
+			fmt.Fprint(w, ")")
+
+		case nodes.AEXPR_LIKE, nodes.AEXPR_ILIKE, nodes.AEXPR_SIMILAR:
+			// [NOT] LIKE - name must be "~~" or "!~~"
+			// [NOT] ILIKE - name must be "~~*" or "!~~*"
+			// [NOT] SIMILAR - name must be "~" or "!~"
+			op, err := aExprOp(node)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/LIKE)")
+			}
+			var keyword string
+			switch op {
+			case "~~":
+				keyword = "LIKE"
+			case "!~~":
+				keyword = "NOT LIKE"
+			case "~~*":
+				keyword = "ILIKE"
+			case "!~~*":
+				keyword = "NOT ILIKE"
+			case "~":
+				keyword = "SIMILAR TO"
+			case "!~":
+				keyword = "NOT SIMILAR TO"
+			default:
+				return false, fmt.Errorf("operator %s not valid for A_Expr subtype %v", op, node.Kind)
+			}
+			err = t.transformOperand(w, node.Lexpr, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/LIKE)")
+			}
+			fmt.Fprintf(w, " %s ", keyword)
+			err = t.transformPattern(w, node.Rexpr, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/LIKE)")
+			}
+
+		case nodes.AEXPR_BETWEEN, nodes.AEXPR_NOT_BETWEEN, nodes.AEXPR_BETWEEN_SYM, nodes.AEXPR_NOT_BETWEEN_SYM:
+			var keyword string
+			switch node.Kind {
+			case nodes.AEXPR_BETWEEN:
+				keyword = "BETWEEN"
+			case nodes.AEXPR_NOT_BETWEEN:
+				keyword = "NOT BETWEEN"
+			case nodes.AEXPR_BETWEEN_SYM:
+				keyword = "BETWEEN SYMMETRIC"
+			case nodes.AEXPR_NOT_BETWEEN_SYM:
+				keyword = "NOT BETWEEN SYMMETRIC"
+			}
+			list, ok := node.Rexpr.(nodes.List)
+			if !ok {
+				return false, fmt.Errorf("right side of BETWEEN is a %T, want List", node.Rexpr)
+			}
+			if len(list.Items) != 2 {
+				return false, fmt.Errorf("%d bounds for BETWEEN, want 2", len(list.Items))
+			}
+			err := t.transformOperand(w, node.Lexpr, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/BETWEEN)")
+			}
+			fmt.Fprintf(w, " %s ", keyword)
+			err = t.transformOperand(w, list.Items[0], env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/BETWEEN)")
+			}
+			fmt.Fprint(w, " AND ")
+			err = t.transformOperand(w, list.Items[1], env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (A_Expr/BETWEEN)")
+			}
+
 		default:
 			return false, fmt.Errorf("A_Expr subtype %v not implemented", node.Kind)
 
-			// case nodes.AEXPR_OP_ALL: // scalar op ALL (array)
-			// case nodes.AEXPR_DISTINCT: // IS DISTINCT FROM - name must be "="
-			// case nodes.AEXPR_NULLIF: // NULLIF - name must be "="
 			// case nodes.AEXPR_OF: // IS [NOT] OF - name must be "=" or "<>"
-			// case nodes.AEXPR_IN: // [NOT] IN - name must be "=" or "<>"
-			// case nodes.AEXPR_LIKE: // [NOT] LIKE - name must be "~~" or "!~~"
-			// case nodes.AEXPR_ILIKE: // [NOT] ILIKE - name must be "~~*" or "!~~*"
-			// case nodes.AEXPR_SIMILAR: // [NOT] SIMILAR - name must be "~" or "!~"
-			// case nodes.AEXPR_BETWEEN: // name must be "BETWEEN"
-			// case nodes.AEXPR_NOT_BETWEEN: // name must be "NOT BETWEEN"
-			// case nodes.AEXPR_BETWEEN_SYM: // name must be "BETWEEN SYMMETRIC"
-			// case nodes.AEXPR_NOT_BETWEEN_SYM: // name must be "NOT BETWEEN SYMMETRIC"
 			// case nodes.AEXPR_PAREN: // nameless dummy node for parentheses
 		}
 		return false, nil
@@ -703,41 +1568,119 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 			return false, errors.Wrap(err, "transformNode (FuncCall)")
 		}
 		fmt.Fprint(w, "(")
-		if len(node.Args.Items) == 0 && node.AggStar {
+		if node.AggStar {
+			if len(node.Args.Items) > 0 || node.AggDistinct || node.FuncVariadic {
+				return false, fmt.Errorf("function call with * has other arguments or modifiers")
+			}
 			fmt.Fprint(w, "*")
 		} else {
-			err = commaSeparated(w, node.Args.Items, env, t.transformNode)
+			if node.AggDistinct {
+				fmt.Fprint(w, "DISTINCT ")
+			}
+			for i, arg := range node.Args.Items {
+				if i > 0 {
+					fmt.Fprint(w, ", ")
+				}
+				if node.FuncVariadic && i == len(node.Args.Items)-1 {
+					fmt.Fprint(w, "VARIADIC ")
+				}
+				err = t.transformNode(w, arg, env)
+				if err != nil {
+					return false, errors.Wrap(err, "transformNode (FuncCall)")
+				}
+			}
+		}
+		if len(node.AggOrder.Items) > 0 && !node.AggWithinGroup {
+			fmt.Fprint(w, " ORDER BY ")
+			err = commaSeparated(w, node.AggOrder.Items, env, t.transformSortBy)
 			if err != nil {
 				return false, errors.Wrap(err, "transformNode (FuncCall)")
 			}
 		}
 		fmt.Fprint(w, ")")
+		if node.AggWithinGroup {
+			if len(node.AggOrder.Items) == 0 {
+				return false, fmt.Errorf("WITHIN GROUP with no ORDER BY")
+			}
+			fmt.Fprint(w, " WITHIN GROUP (ORDER BY ")
+			err = commaSeparated(w, node.AggOrder.Items, env, t.transformSortBy)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (FuncCall)")
+			}
+			fmt.Fprint(w, ")")
+		}
+		if node.AggFilter != nil {
+			fmt.Fprint(w, " FILTER (WHERE ")
+			err = t.transformNode(w, node.AggFilter, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (FuncCall)")
+			}
+			fmt.Fprint(w, ")")
+		}
+		if node.Over != nil {
+			fmt.Fprint(w, " OVER ")
+			over := *node.Over
+			// OVER name, referring to a window in the WINDOW clause,
+			// is parsed as a WindowDef with nothing but a Name.
+			if over.Name != nil && over.Refname == nil && len(over.PartitionClause.Items) == 0 && len(over.OrderClause.Items) == 0 && over.FrameOptions&frameOptionNonDefault == 0 {
+				fmt.Fprint(w, safestr(*over.Name))
+			} else {
+				err = t.transformWindowDef(w, over, env)
+				if err != nil {
+					return false, errors.Wrap(err, "transformNode (FuncCall)")
+				}
+			}
+		}
 		return true, nil
 
 	case nodes.BoolExpr:
 		return false, t.transformBoolExpr(w, node, env)
 
 	case nodes.SubLink:
-		return false, t.transformSubLink(w, node, env)
+		// Scalar and ARRAY subqueries are fully parenthesized;
+		// the others are comparisons.
+		isAtomic := node.SubLinkType == nodes.EXPR_SUBLINK || node.SubLinkType == nodes.ARRAY_SUBLINK
+		return isAtomic, t.transformSubLink(w, node, env)
 
 	case nodes.A_Const:
-		return true, t.transformConst(w, node)
+		// A negative number is not atomic: -1::text means -(1::text).
+		isAtomic := true
+		switch val := node.Val.(type) {
+		case nodes.Integer:
+			isAtomic = val.Ival >= 0
+		case nodes.Float:
+			isAtomic = !strings.HasPrefix(val.Str, "-")
+		}
+		return isAtomic, t.transformConst(w, node)
 
 	case nodes.RangeVar:
-		fmt.Fprint(w, safestr(*node.Relname))
+		name := qualifiedName(node)
+		if !node.Inh {
+			fmt.Fprint(w, "ONLY ")
+		}
+		fmt.Fprint(w, name)
+		if env[name] == isOuterCTE {
+			env[name] = isCTE
+		}
+		// A name from an enclosing query (isOuterTable) is shadowed by this one.
 		if node.Alias != nil {
-			fmt.Fprintf(w, " %s", safestr(*node.Alias.Aliasname))
-			if env != nil && env[*node.Alias.Aliasname] == noStatus {
-				st := env[*node.Relname]
-				if st == noStatus {
-					st = needsTenantID
+			alias := safestr(*node.Alias.Aliasname)
+			fmt.Fprintf(w, " %s", alias)
+			if env != nil && (env[alias] == noStatus || env[alias] == isOuterTable) {
+				// An alias of a CTE is a CTE.
+				// Any other alias is a new instance of its table,
+				// needing its own tenant ID condition
+				// whatever the status of other instances.
+				st := needsTenantID
+				if env[name] == isCTE {
+					st = isCTE
 				}
-				env[*node.Alias.Aliasname] = st
+				env[alias] = st
 			}
 			return false, nil
 		}
-		if env != nil && env[*node.Relname] == noStatus {
-			env[*node.Relname] = needsTenantID
+		if env != nil && (env[name] == noStatus || env[name] == isOuterTable) {
+			env[name] = needsTenantID
 		}
 		return true, nil
 
@@ -767,21 +1710,54 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 		}
 		return false, nil
 
+	case nodes.BooleanTest:
+		err := t.transformOperand(w, node.Arg, env)
+		if err != nil {
+			return false, errors.Wrap(err, "transformNode (BooleanTest)")
+		}
+		switch node.Booltesttype {
+		case nodes.IS_TRUE:
+			fmt.Fprint(w, " IS TRUE")
+		case nodes.IS_NOT_TRUE:
+			fmt.Fprint(w, " IS NOT TRUE")
+		case boolTestIsFalse:
+			fmt.Fprint(w, " IS FALSE")
+		case boolTestIsNotFalse:
+			fmt.Fprint(w, " IS NOT FALSE")
+		case boolTestIsUnknown:
+			fmt.Fprint(w, " IS UNKNOWN")
+		case boolTestIsNotUnknown:
+			fmt.Fprint(w, " IS NOT UNKNOWN")
+		default:
+			return false, fmt.Errorf("BooleanTest type %v not implemented", node.Booltesttype)
+		}
+		return false, nil
+
 	case nodes.CaseExpr:
+		fmt.Fprint(w, "CASE ")
 		if node.Arg != nil {
-			return false, errors.New("CASE testexpr WHEN ... not implemented")
+			// Simple form: CASE testexpr WHEN value THEN ...
+			err := t.transformNode(w, node.Arg, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (CaseExpr Arg)")
+			}
+			fmt.Fprint(w, " ")
 		}
-		fmt.Fprint(w, "CASE ")
-		for _, arg := range node.Args.Items {
+		for i, arg := range node.Args.Items {
+			if i > 0 {
+				fmt.Fprint(w, " ")
+			}
 			err := t.transformNode(w, arg, env)
 			if err != nil {
 				return false, errors.Wrap(err, "transformNode (CaseExpr Args)")
 			}
 		}
-		fmt.Fprint(w, " ELSE ")
-		err := t.transformNode(w, node.Defresult, env)
-		if err != nil {
-			return false, errors.Wrap(err, "transformNode (CaseExpr Defresult)")
+		if node.Defresult != nil {
+			fmt.Fprint(w, " ELSE ")
+			err := t.transformNode(w, node.Defresult, env)
+			if err != nil {
+				return false, errors.Wrap(err, "transformNode (CaseExpr Defresult)")
+			}
 		}
 		fmt.Fprint(w, " END")
 		return true, nil
@@ -800,61 +1776,7 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 		return true, nil
 
 	case nodes.JoinExpr:
-		// Set the status of the main table that the query performs LEFT JOIN on to "isLeftJoinTable"
-		// because we don't want to add the tenant ID of the main table in the join condition as
-		// LEFT JOIN will still return rows that don't satisfy the join condition. We want to add the
-		// tenant ID in the where clause instead. The effect of doing a LEFT JOIN WHERE is essentially
-		// the same as doing a INNER JOIN in our case. We are doing it because of Postgres performance
-		// reasons.
-		// Only the leftmost table will be set.
-		if node.Jointype == nodes.JOIN_LEFT {
-			if n, ok := node.Larg.(nodes.RangeVar); ok {
-				if env != nil {
-					if n.Alias != nil {
-						maybeSetIsLeftJoinTable(env, *n.Alias.Aliasname)
-					} else {
-						maybeSetIsLeftJoinTable(env, *n.Relname)
-					}
-				}
-			}
-		}
-		err := t.transformNode(w, node.Larg, env)
-		if err != nil {
-			return false, errors.Wrap(err, "transformNode (JoinExpr)")
-		}
-		switch node.Jointype {
-		case nodes.JOIN_INNER:
-			fmt.Fprint(w, " INNER JOIN ")
-		case nodes.JOIN_LEFT:
-			fmt.Fprint(w, " LEFT JOIN ")
-
-		default:
-			return false, fmt.Errorf("JoinExpr subtype %v not implemented", node.Jointype)
-
-			// case nodes.JOIN_FULL:
-			// case nodes.JOIN_RIGHT:
-		}
-		err = t.transformNode(w, node.Rarg, env)
-		if err != nil {
-			return false, errors.Wrap(err, "transformNode (JoinExpr)")
-		}
-		if node.Quals != nil {
-			m, err := extractTables([]nodes.Node{node.Larg, node.Rarg})
-			if err != nil {
-				return false, errors.Wrap(err, "transformNode (JoinExpr)")
-			}
-			var tables sort.StringSlice
-			for table := range m {
-				tables = append(tables, table)
-			}
-			tables.Sort()
-			fmt.Fprint(w, " ON ")
-			err = t.transformWhereHelper(w, node.Quals, env, false, tables)
-			if err != nil {
-				return false, errors.Wrap(err, "transformNode (JoinExpr)")
-			}
-		}
-		return false, nil
+		return false, t.transformJoinExpr(w, node, env, false)
 
 	case nodes.RangeFunction:
 		if len(node.Functions.Items) != 1 {
@@ -867,24 +1789,22 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 		if len(f.Items) == 0 {
 			return false, fmt.Errorf("empty subitems list in Functions.Items[0]")
 		}
+		if node.Lateral {
+			fmt.Fprint(w, "LATERAL ")
+		}
 		err := t.transformNode(w, f.Items[0], env)
 		if err != nil {
 			return false, errors.Wrap(err, "transformNode (RangeFunction)")
 		}
+		if node.Ordinality {
+			fmt.Fprint(w, " WITH ORDINALITY")
+		}
 		if node.Alias != nil {
-			fmt.Fprintf(w, " AS %s(", safestr(*node.Alias.Aliasname))
-			err = commaSeparated(w, node.Alias.Colnames.Items, env, func(w io.Writer, col nodes.Node, env environ) error {
-				s, ok := col.(nodes.String)
-				if !ok {
-					return fmt.Errorf("range function alias is a %T, want String", col)
-				}
-				fmt.Fprint(w, safestr(s.Str))
-				return nil
-			})
+			fmt.Fprintf(w, " AS %s", safestr(*node.Alias.Aliasname))
+			err = transformColnames(w, node.Alias.Colnames)
 			if err != nil {
 				return false, errors.Wrap(err, "transformNode (RangeFunction)")
 			}
-			fmt.Fprint(w, ")")
 		}
 		return false, nil
 
@@ -897,13 +1817,29 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 		fmt.Fprint(w, ")")
 		return true, nil
 
+	case nodes.A_ArrayExpr:
+		fmt.Fprint(w, "ARRAY[")
+		err := commaSeparated(w, node.Elements.Items, env, t.transformNode)
+		if err != nil {
+			return false, errors.Wrap(err, "transformNode (A_ArrayExpr)")
+		}
+		fmt.Fprint(w, "]")
+		return true, nil
+
 	case nodes.SQLValueFunction:
-		switch node.Op {
-		case nodes.SVFOP_CURRENT_TIMESTAMP:
+		if node.Op == nodes.SVFOP_CURRENT_TIMESTAMP {
 			fmt.Fprint(w, "NOW()")
-		default:
+			return true, nil
+		}
+		name, ok := sqlValueFunctions[node.Op]
+		if !ok {
 			return false, fmt.Errorf("SQLValueFunction %d not handled", node.Op)
 		}
+		fmt.Fprint(w, name)
+		switch node.Op {
+		case nodes.SVFOP_CURRENT_TIME_N, nodes.SVFOP_CURRENT_TIMESTAMP_N, nodes.SVFOP_LOCALTIME_N, nodes.SVFOP_LOCALTIMESTAMP_N:
+			fmt.Fprintf(w, "(%d)", node.Typmod)
+		}
 		return true, nil
 
 	default:
@@ -911,6 +1847,305 @@ func (t *transformer) transformNodeHelper(w io.Writer, node nodes.Node, env envi
 	}
 }
 
+// sqlValueFunctions maps each SQLValueFunction op to its SQL keyword.
+// The _N variants take a precision, emitted separately.
+var sqlValueFunctions = map[nodes.SQLValueFunctionOp]string{
+	nodes.SVFOP_CURRENT_DATE:        "CURRENT_DATE",
+	nodes.SVFOP_CURRENT_TIME:        "CURRENT_TIME",
+	nodes.SVFOP_CURRENT_TIME_N:      "CURRENT_TIME",
+	nodes.SVFOP_CURRENT_TIMESTAMP:   "CURRENT_TIMESTAMP",
+	nodes.SVFOP_CURRENT_TIMESTAMP_N: "CURRENT_TIMESTAMP",
+	nodes.SVFOP_LOCALTIME:           "LOCALTIME",
+	nodes.SVFOP_LOCALTIME_N:         "LOCALTIME",
+	nodes.SVFOP_LOCALTIMESTAMP:      "LOCALTIMESTAMP",
+	nodes.SVFOP_LOCALTIMESTAMP_N:    "LOCALTIMESTAMP",
+	nodes.SVFOP_CURRENT_ROLE:        "CURRENT_ROLE",
+	nodes.SVFOP_CURRENT_USER:        "CURRENT_USER",
+	nodes.SVFOP_USER:                "USER",
+	nodes.SVFOP_SESSION_USER:        "SESSION_USER",
+	nodes.SVFOP_CURRENT_CATALOG:     "CURRENT_CATALOG",
+	nodes.SVFOP_CURRENT_SCHEMA:      "CURRENT_SCHEMA",
+}
+
+// aExprOp returns the single operator name of an A_Expr node.
+func aExprOp(node nodes.A_Expr) (string, error) {
+	if len(node.Name.Items) != 1 {
+		return "", fmt.Errorf("%d names for A_Expr operator, want 1", len(node.Name.Items))
+	}
+	op, ok := node.Name.Items[0].(nodes.String)
+	if !ok {
+		return "", fmt.Errorf("name for A_Expr operator is a %T, want Str", node.Name.Items[0])
+	}
+	return op.Str, nil
+}
+
+// transformPattern emits the right-hand side of a LIKE, ILIKE, or SIMILAR TO expression.
+// The parser wraps the pattern of LIKE ... ESCAPE in a call to like_escape,
+// and the pattern of SIMILAR TO in a call to similar_escape.
+// These calls are turned back into the original syntax;
+// emitting them as-is would cause SIMILAR TO patterns to be escaped twice when reparsed.
+func (t *transformer) transformPattern(w io.Writer, node nodes.Node, env environ) error {
+	if f, ok := node.(nodes.FuncCall); ok && len(f.Funcname.Items) == 2 && len(f.Args.Items) == 2 {
+		schema, ok1 := f.Funcname.Items[0].(nodes.String)
+		name, ok2 := f.Funcname.Items[1].(nodes.String)
+		if ok1 && ok2 && schema.Str == "pg_catalog" && (name.Str == "like_escape" || name.Str == "similar_escape") {
+			err := t.transformNode(w, f.Args.Items[0], env)
+			if err != nil {
+				return errors.Wrap(err, "transformPattern")
+			}
+			if !isNullConst(f.Args.Items[1]) {
+				fmt.Fprint(w, " ESCAPE ")
+				err = t.transformNode(w, f.Args.Items[1], env)
+				if err != nil {
+					return errors.Wrap(err, "transformPattern")
+				}
+			}
+			return nil
+		}
+	}
+	return t.transformNode(w, node, env)
+}
+
+// The remaining BoolTestType values.
+// These mirror Postgres's primnodes.h;
+// pg_query_go defines only IS_TRUE and IS_NOT_TRUE.
+const (
+	boolTestIsFalse nodes.BoolTestType = nodes.IS_NOT_TRUE + 1 + iota
+	boolTestIsNotFalse
+	boolTestIsUnknown
+	boolTestIsNotUnknown
+)
+
+// transformJoinExpr emits a JOIN and places the tenant ID conditions for its tables.
+//
+// For the tables on the preserved side of a LEFT or RIGHT JOIN
+// (the left side of a LEFT JOIN, the right side of a RIGHT JOIN)
+// we don't want to add the tenant ID in the join condition,
+// as an outer join will still return rows that don't satisfy the join condition.
+// Those tables get the status "isLeftJoinTable"
+// and their tenant ID conditions are added in the WHERE clause instead.
+// The effect of doing a LEFT JOIN WHERE is essentially
+// the same as doing an INNER JOIN in our case.
+// We are doing it because of Postgres performance reasons.
+// Tables on the nullable side, and on both sides of an INNER JOIN,
+// get their tenant ID conditions in the ON clause.
+//
+// Some tables can't get their tenant ID condition in either place:
+// the nullable side of an outer join with no ON clause (USING or NATURAL),
+// both sides of a FULL JOIN,
+// and anything inside an aliased join (whose tables are not visible outside it).
+// Each such table is replaced with a subquery selecting only the tenant's rows,
+// aliased to the table's original name.
+// The selfScoped flag requests this for every table in the join
+// whose tenant ID condition can't go in the join's own ON clause.
+func (t *transformer) transformJoinExpr(w io.Writer, node nodes.JoinExpr, env environ, selfScoped bool) error {
+	hasAlias := node.Alias != nil && node.Alias.Aliasname != nil && *node.Alias.Aliasname != ""
+	if hasAlias {
+		selfScoped = true
+	}
+	hasQuals := node.Quals != nil
+
+	var (
+		keyword                     string
+		scopeLeft, scopeRight       bool
+		leftDeferred, rightDeferred bool
+	)
+	switch node.Jointype {
+	case nodes.JOIN_INNER:
+		if hasQuals || node.IsNatural || len(node.UsingClause.Items) > 0 {
+			keyword = "INNER JOIN"
+		} else {
+			keyword = "CROSS JOIN"
+		}
+		scopeLeft = selfScoped && !hasQuals
+		scopeRight = scopeLeft
+
+	case nodes.JOIN_LEFT:
+		keyword = "LEFT JOIN"
+		scopeLeft = selfScoped
+		scopeRight = !hasQuals
+		leftDeferred = true
+
+	case nodes.JOIN_RIGHT:
+		keyword = "RIGHT JOIN"
+		scopeLeft = !hasQuals
+		scopeRight = selfScoped
+		rightDeferred = true
+
+	case nodes.JOIN_FULL:
+		keyword = "FULL JOIN"
+		scopeLeft = true
+		scopeRight = true
+
+	default:
+		return fmt.Errorf("JoinExpr subtype %v not implemented", node.Jointype)
+	}
+	if node.IsNatural {
+		keyword = "NATURAL " + keyword
+	}
+
+	if hasAlias {
+		fmt.Fprint(w, "(")
+	}
+	err := t.transformJoinArg(w, node.Larg, env, scopeLeft)
+	if err != nil {
+		return errors.Wrap(err, "transformJoinExpr")
+	}
+	fmt.Fprintf(w, " %s ", keyword)
+	// A join nested on the right needs parentheses
+	// (unless it has an alias, in which case it supplies its own).
+	rj, parens := node.Rarg.(nodes.JoinExpr)
+	parens = parens && (rj.Alias == nil || rj.Alias.Aliasname == nil || *rj.Alias.Aliasname == "")
+	if parens {
+		fmt.Fprint(w, "(")
+	}
+	err = t.transformJoinArg(w, node.Rarg, env, scopeRight)
+	if err != nil {
+		return errors.Wrap(err, "transformJoinExpr")
+	}
+	if parens {
+		fmt.Fprint(w, ")")
+	}
+
+	if len(node.UsingClause.Items) > 0 {
+		fmt.Fprint(w, " USING (")
+		err = commaSeparated(w, node.UsingClause.Items, env, func(w io.Writer, col nodes.Node, env environ) error {
+			s, ok := col.(nodes.String)
+			if !ok {
+				return fmt.Errorf("USING item is a %T, want String", col)
+			}
+			fmt.Fprint(w, safestr(s.Str))
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "transformJoinExpr")
+		}
+		fmt.Fprint(w, ")")
+	}
+
+	if hasQuals {
+		left, err := extractTables([]nodes.Node{node.Larg})
+		if err != nil {
+			return errors.Wrap(err, "transformJoinExpr")
+		}
+		right, err := extractTables([]nodes.Node{node.Rarg})
+		if err != nil {
+			return errors.Wrap(err, "transformJoinExpr")
+		}
+		var tables sort.StringSlice
+		for table := range left {
+			tables = append(tables, table)
+			setDeferred(env, table, leftDeferred)
+		}
+		for table := range right {
+			tables = append(tables, table)
+			setDeferred(env, table, rightDeferred)
+		}
+		tables.Sort()
+		fmt.Fprint(w, " ON ")
+		err = t.transformWhereHelper(w, node.Quals, env, false, tables)
+		if err != nil {
+			return errors.Wrap(err, "transformJoinExpr")
+		}
+	}
+
+	if hasAlias {
+		fmt.Fprintf(w, ") AS %s", safestr(*node.Alias.Aliasname))
+		err = transformColnames(w, node.Alias.Colnames)
+		if err != nil {
+			return errors.Wrap(err, "transformJoinExpr")
+		}
+	}
+	return nil
+}
+
+// transformColnames emits the parenthesized column names of an alias,
+// as in AS name(col1, col2),
+// if there are any.
+func transformColnames(w io.Writer, colnames nodes.List) error {
+	if len(colnames.Items) == 0 {
+		return nil
+	}
+	fmt.Fprint(w, "(")
+	for i, col := range colnames.Items {
+		s, ok := col.(nodes.String)
+		if !ok {
+			return fmt.Errorf("alias column name is a %T, want String", col)
+		}
+		if i > 0 {
+			fmt.Fprint(w, ", ")
+		}
+		fmt.Fprint(w, safestr(s.Str))
+	}
+	fmt.Fprint(w, ")")
+	return nil
+}
+
+// setDeferred marks a table that is still awaiting its tenant ID condition
+// as needing it in the WHERE clause (deferred is true)
+// or in the ON clause about to be emitted (deferred is false).
+func setDeferred(env environ, table string, deferred bool) {
+	switch env[table] {
+	case needsTenantID:
+		if deferred {
+			env[table] = isLeftJoinTable
+		}
+	case isLeftJoinTable:
+		if !deferred {
+			env[table] = needsTenantID
+		}
+	}
+}
+
+// transformJoinArg emits one side of a JoinExpr.
+// If scope is true,
+// the tables on that side must get their tenant ID conditions right here.
+func (t *transformer) transformJoinArg(w io.Writer, node nodes.Node, env environ, scope bool) error {
+	if !scope {
+		return t.transformNode(w, node, env)
+	}
+	switch node := node.(type) {
+	case nodes.RangeVar:
+		if st := env[qualifiedName(node)]; st == isCTE || st == isOuterCTE {
+			return t.transformNode(w, node, env)
+		}
+		// The subquery's alias cannot be qualified,
+		// so references to a schema-qualified table by its qualified name would break,
+		// and two such tables could end up with the same alias.
+		if node.Alias == nil && node.Schemaname != nil && *node.Schemaname != "" {
+			return fmt.Errorf("cannot scope table %s on this side of a join without an alias", qualifiedName(node))
+		}
+		name := safestr(*node.Relname)
+		if node.Alias != nil {
+			name = safestr(*node.Alias.Aliasname)
+		}
+		rv := node
+		rv.Alias = nil
+		fmt.Fprint(w, "(SELECT * FROM ")
+		err := t.transformNode(w, rv, newEnv())
+		if err != nil {
+			return errors.Wrap(err, "transformJoinArg")
+		}
+		fmt.Fprintf(w, " WHERE %s = ", safestr(t.driver.TenantIDCol))
+		t.addTenantID(w)
+		fmt.Fprintf(w, ") AS %s", name)
+		if node.Alias != nil {
+			// SELECT * keeps the table's columns in order,
+			// so the alias's column list still names the same ones.
+			err = transformColnames(w, node.Alias.Colnames)
+			if err != nil {
+				return errors.Wrap(err, "transformJoinArg")
+			}
+		}
+		env[name] = hasTenantID
+		return nil
+
+	case nodes.JoinExpr:
+		return t.transformJoinExpr(w, node, env, true)
+	}
+	return t.transformNode(w, node, env)
+}
+
 func (t *transformer) specialCaseBoolLiteral(w io.Writer, typecast nodes.TypeCast) bool {
 	arg, ok := typecast.Arg.(nodes.A_Const)
 	if !ok {
@@ -951,8 +2186,66 @@ func (t *transformer) transformNodeSafe(w io.Writer, node nodes.Node, env enviro
 	return t.transformNode(w, node, env)
 }
 
-func (t *transformer) transformIndexElem(w io.Writer, indexElem nodes.IndexElem) error {
-	fmt.Fprint(w, safestr(*indexElem.Name))
+func (t *transformer) transformIndexElem(w io.Writer, indexElem nodes.IndexElem, env environ) error {
+	switch {
+	case indexElem.Name != nil:
+		fmt.Fprint(w, safestr(*indexElem.Name))
+
+	case indexElem.Expr != nil:
+		// A function call may appear bare;
+		// any other expression must be parenthesized.
+		if _, ok := indexElem.Expr.(nodes.FuncCall); ok {
+			err := t.transformNode(w, indexElem.Expr, env)
+			if err != nil {
+				return errors.Wrap(err, "transformIndexElem")
+			}
+		} else {
+			fmt.Fprint(w, "(")
+			err := t.transformNode(w, indexElem.Expr, env)
+			if err != nil {
+				return errors.Wrap(err, "transformIndexElem")
+			}
+			fmt.Fprint(w, ")")
+		}
+
+	default:
+		return errors.New("index element has neither a name nor an expression")
+	}
+
+	if len(indexElem.Collation.Items) > 0 {
+		fmt.Fprint(w, " COLLATE ")
+		err := t.transformQualifiedName(w, indexElem.Collation)
+		if err != nil {
+			return errors.Wrap(err, "transformIndexElem (collation)")
+		}
+	}
+	if len(indexElem.Opclass.Items) > 0 {
+		fmt.Fprint(w, " ")
+		err := t.transformQualifiedName(w, indexElem.Opclass)
+		if err != nil {
+			return errors.Wrap(err, "transformIndexElem (opclass)")
+		}
+	}
+	if indexElem.Ordering != nodes.SORTBY_DEFAULT || indexElem.NullsOrdering != nodes.SORTBY_NULLS_DEFAULT {
+		return errors.New("ordering in index element not supported")
+	}
+	return nil
+}
+
+// transformQualifiedName emits a possibly qualified name,
+// such as a collation or operator class,
+// given as a list of Strings.
+func (t *transformer) transformQualifiedName(w io.Writer, names nodes.List) error {
+	for i, item := range names.Items {
+		s, ok := item.(nodes.String)
+		if !ok {
+			return fmt.Errorf("name item %d is a %T, want String", i, item)
+		}
+		if i > 0 {
+			fmt.Fprint(w, ".")
+		}
+		fmt.Fprint(w, safestr(s.Str))
+	}
 	return nil
 }
 
@@ -968,20 +2261,33 @@ func (t *transformer) transformIdent(w io.Writer, names nodes.List) error {
 	var str string
 	switch len(items) {
 	case 1:
-		str = strItem0.Str
+		str = safestr(strItem0.Str)
 
 	case 2:
-		if strItem0.Str != "pg_catalog" {
-			return fmt.Errorf("2-item identifier has \"%s\" prefix, want pg_catalog", strItem0.Str)
-		}
 		strItem1, ok := items[1].(nodes.String)
 		if !ok {
 			return fmt.Errorf("identifier item 1 is a %T, want String", items[1])
 		}
+		if strItem0.Str != "pg_catalog" {
+			str = safestr(strItem0.Str) + "." + safestr(strItem1.Str)
+			break
+		}
 		str = strings.ToUpper(strItem1.Str)
 
+	case 3:
+		// A name qualified by catalog and schema.
+		var parts []string
+		for i, item := range items {
+			strItem, ok := item.(nodes.String)
+			if !ok {
+				return fmt.Errorf("identifier item %d is a %T, want String", i, item)
+			}
+			parts = append(parts, safestr(strItem.Str))
+		}
+		str = strings.Join(parts, ".")
+
 	default:
-		return fmt.Errorf("identifier has %d items, want 1 or 2", len(items))
+		return fmt.Errorf("identifier has %d items, want 1, 2, or 3", len(items))
 	}
 
 	switch str {
@@ -1048,91 +2354,333 @@ func (t *transformer) transformBoolSubexpr(w io.Writer, expr nodes.Node, env env
 func (t *transformer) transformSubLink(w io.Writer, subLink nodes.SubLink, env environ) error {
 	switch subLink.SubLinkType {
 	case nodes.EXISTS_SUBLINK:
-		fmt.Fprint(w, "EXISTS (")
-		sel, ok := subLink.Subselect.(nodes.SelectStmt)
-		if !ok {
-			return fmt.Errorf("EXISTS subselect is a %T, want SelectStmt", subLink.Subselect)
-		}
-		err := t.transformSelect(w, sel, newEnv(), nil)
+		fmt.Fprint(w, "EXISTS ")
+		err := t.transformSubselect(w, subLink.Subselect, env)
 		if err != nil {
 			return errors.Wrap(err, "transformSubLink (EXISTS)")
 		}
-		fmt.Fprint(w, ")")
 
 	case nodes.ANY_SUBLINK:
 		err := t.transformNode(w, subLink.Testexpr, env)
 		if err != nil {
 			return errors.Wrap(err, "transformSubLink (ANY)")
 		}
-		fmt.Fprint(w, " IN (")
-		sel, ok := subLink.Subselect.(nodes.SelectStmt)
-		if !ok {
-			return fmt.Errorf("EXISTS subselect is a %T, want SelectStmt", subLink.Subselect)
+		// Plain IN has no operator name; op ANY and op SOME do.
+		if len(subLink.OperName.Items) == 0 {
+			fmt.Fprint(w, " IN ")
+		} else {
+			op, err := subLinkOp(subLink)
+			if err != nil {
+				return errors.Wrap(err, "transformSubLink (ANY)")
+			}
+			fmt.Fprintf(w, " %s ANY ", op)
 		}
-		err = t.transformSelect(w, sel, newEnv(), nil)
+		err = t.transformSubselect(w, subLink.Subselect, env)
 		if err != nil {
 			return errors.Wrap(err, "transformSubLink (ANY)")
 		}
-		fmt.Fprint(w, ")")
+
+	case nodes.ALL_SUBLINK:
+		err := t.transformNode(w, subLink.Testexpr, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSubLink (ALL)")
+		}
+		op, err := subLinkOp(subLink)
+		if err != nil {
+			return errors.Wrap(err, "transformSubLink (ALL)")
+		}
+		fmt.Fprintf(w, " %s ALL ", op)
+		err = t.transformSubselect(w, subLink.Subselect, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSubLink (ALL)")
+		}
+
+	case nodes.ROWCOMPARE_SUBLINK:
+		err := t.transformNode(w, subLink.Testexpr, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSubLink (ROWCOMPARE)")
+		}
+		op, err := subLinkOp(subLink)
+		if err != nil {
+			return errors.Wrap(err, "transformSubLink (ROWCOMPARE)")
+		}
+		fmt.Fprintf(w, " %s ", op)
+		err = t.transformSubselect(w, subLink.Subselect, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSubLink (ROWCOMPARE)")
+		}
+
+	case nodes.EXPR_SUBLINK, nodes.MULTIEXPR_SUBLINK:
+		// MULTIEXPR is the source of UPDATE ... SET (a, b) = (SELECT ...).
+		err := t.transformSubselect(w, subLink.Subselect, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSubLink (EXPR)")
+		}
+
+	case nodes.ARRAY_SUBLINK:
+		fmt.Fprint(w, "ARRAY")
+		err := t.transformSubselect(w, subLink.Subselect, env)
+		if err != nil {
+			return errors.Wrap(err, "transformSubLink (ARRAY)")
+		}
 
 	default:
 		return fmt.Errorf("SubLink type %v not implemented", subLink.SubLinkType)
 
-		// case nodes.ALL_SUBLINK:
-		// case nodes.ROWCOMPARE_SUBLINK:
-		// case nodes.EXPR_SUBLINK:
-		// case nodes.MULTIEXPR_SUBLINK:
-		// case nodes.ARRAY_SUBLINK:
 		// case nodes.CTE_SUBLINK:
 	}
 	return nil
 }
 
+// transformSubselect emits the parenthesized SELECT of a SubLink.
+// The subquery gets its own environment,
+// seeded with the CTE names visible in env,
+// and so its own tenant ID predicate.
+func (t *transformer) transformSubselect(w io.Writer, node nodes.Node, env environ) error {
+	sel, ok := node.(nodes.SelectStmt)
+	if !ok {
+		return fmt.Errorf("subselect is a %T, want SelectStmt", node)
+	}
+	subEnv := newSubEnv(env)
+	fmt.Fprint(w, "(")
+	err := t.transformSelect(w, sel, subEnv, nil)
+	if err != nil {
+		return errors.Wrap(err, "transformSubselect")
+	}
+	fmt.Fprint(w, ")")
+	return nil
+}
+
+// subLinkOp returns the single operator name of a SubLink node.
+func subLinkOp(subLink nodes.SubLink) (string, error) {
+	if len(subLink.OperName.Items) != 1 {
+		return "", fmt.Errorf("%d names for SubLink operator, want 1", len(subLink.OperName.Items))
+	}
+	op, ok := subLink.OperName.Items[0].(nodes.String)
+	if !ok {
+		return "", fmt.Errorf("name for SubLink operator is a %T, want Str", subLink.OperName.Items[0])
+	}
+	return op.Str, nil
+}
+
+// isPredicate tells whether node is a boolean expression or test
+// whose SQL form binds more loosely than an ordinary operator.
+func isPredicate(node nodes.Node) bool {
+	switch node := node.(type) {
+	case nodes.BoolExpr, nodes.BooleanTest, nodes.NullTest:
+		return true
+	case nodes.A_Expr:
+		return node.Kind != nodes.AEXPR_OP && node.Kind != nodes.AEXPR_NULLIF
+	}
+	return false
+}
+
+func isNullConst(node nodes.Node) bool {
+	c, ok := node.(nodes.A_Const)
+	if !ok {
+		return false
+	}
+	_, ok = c.Val.(nodes.Null)
+	return ok
+}
+
 func (t *transformer) transformConst(w io.Writer, node nodes.A_Const) error {
 	switch val := node.Val.(type) {
 	case nodes.Integer:
 		fmt.Fprintf(w, "%d", val.Ival)
 
 	case nodes.Float:
+		// Also used for integers too large for Integer.
+		// Str is the literal text as written.
 		fmt.Fprintf(w, "%s", val.Str)
 
 	case nodes.String:
-		fmt.Fprintf(w, "'%s'", escape(val.Str))
+		fmt.Fprint(w, quoteString(val.Str))
+
+	case nodes.BitString:
+		// Str is the literal's digits prefixed by "b" (binary) or "x" (hex).
+		if len(val.Str) == 0 {
+			return errors.New("empty bit string constant")
+		}
+		switch val.Str[0] {
+		case 'b', 'x':
+			fmt.Fprintf(w, "%s'%s'", strings.ToUpper(val.Str[:1]), val.Str[1:])
+		default:
+			return fmt.Errorf("bit string constant has prefix %q, want b or x", val.Str[:1])
+		}
 
 	case nodes.Null:
 		fmt.Fprint(w, "NULL")
+
+	default:
+		return fmt.Errorf("constant type %T not handled", node.Val)
 	}
 	return nil
 }
 
-func escape(s string) string {
+// quoteString returns s as an SQL string literal.
+// Single quotes are doubled.
+// If s contains a backslash,
+// it uses the escape-string syntax E'...' with backslashes doubled,
+// which means the same thing whatever the setting of standard_conforming_strings.
+func quoteString(s string) string {
 	buf := new(bytes.Buffer)
+	if strings.ContainsRune(s, '\\') {
+		buf.WriteByte('E')
+	}
+	buf.WriteByte('\'')
 	for _, c := range s {
-		if c == '\'' {
-			buf.WriteByte('\'')
+		switch c {
+		case '\'', '\\':
+			buf.WriteRune(c)
 		}
 		buf.WriteRune(c)
 	}
+	buf.WriteByte('\'')
 	return buf.String()
 }
 
 func (t *transformer) transformTypeName(w io.Writer, typeName nodes.TypeName) error {
-	err := t.transformIdent(w, typeName.Names)
+	if typeName.PctType {
+		return errors.New("%TYPE not implemented")
+	}
+	if typeName.Setof {
+		fmt.Fprint(w, "SETOF ")
+	}
+
+	// Typmods normally follow the type name,
+	// but "TIMESTAMP WITH TIME ZONE" and INTERVAL are spelled specially.
+	var (
+		isInterval, isTimestamptz bool
+		typmods                   = typeName.Typmods.Items
+	)
+	if len(typeName.Names.Items) == 2 {
+		if item, ok := typeName.Names.Items[0].(nodes.String); ok && item.Str == "pg_catalog" {
+			if item, ok := typeName.Names.Items[1].(nodes.String); ok {
+				isInterval = item.Str == "interval"
+				isTimestamptz = item.Str == "timestamptz"
+			}
+		}
+	}
+
+	switch {
+	case isInterval:
+		fmt.Fprint(w, "INTERVAL")
+		err := t.transformIntervalTypmods(w, typmods)
+		if err != nil {
+			return errors.Wrap(err, "transformTypeName")
+		}
+
+	case isTimestamptz && len(typmods) > 0:
+		fmt.Fprint(w, "TIMESTAMP")
+		err := t.transformTypmods(w, typmods)
+		if err != nil {
+			return errors.Wrap(err, "transformTypeName")
+		}
+		fmt.Fprint(w, " WITH TIME ZONE")
+
+	default:
+		err := t.transformIdent(w, typeName.Names)
+		if err != nil {
+			return errors.Wrap(err, "transformTypeName")
+		}
+		err = t.transformTypmods(w, typmods)
+		if err != nil {
+			return errors.Wrap(err, "transformTypeName")
+		}
+	}
+
+	for _, item := range typeName.ArrayBounds.Items {
+		ival, ok := item.(nodes.Integer)
+		if !ok {
+			return fmt.Errorf("TypeName array bounds item is a %T, want Integer", item)
+		}
+		if ival.Ival < 0 {
+			fmt.Fprint(w, "[]")
+		} else {
+			fmt.Fprintf(w, "[%d]", ival.Ival)
+		}
+	}
+	return nil
+}
+
+func (t *transformer) transformTypmods(w io.Writer, typmods []nodes.Node) error {
+	if len(typmods) == 0 {
+		return nil
+	}
+	fmt.Fprint(w, "(")
+	err := commaSeparated(w, typmods, nil, t.transformNode)
 	if err != nil {
-		return errors.Wrap(err, "transformTypeName")
+		return errors.Wrap(err, "transformTypmods")
+	}
+	fmt.Fprint(w, ")")
+	return nil
+}
+
+// Interval field bitmasks,
+// from INTERVAL_MASK in Postgres's utils/datetime.h.
+const (
+	intervalMonth  = 1 << 1
+	intervalYear   = 1 << 2
+	intervalDay    = 1 << 3
+	intervalHour   = 1 << 10
+	intervalMinute = 1 << 11
+	intervalSecond = 1 << 12
+
+	intervalFullRange = 0x7fff
+)
+
+var intervalFields = map[int64]string{
+	intervalYear:                 "YEAR",
+	intervalMonth:                "MONTH",
+	intervalDay:                  "DAY",
+	intervalHour:                 "HOUR",
+	intervalMinute:               "MINUTE",
+	intervalSecond:               "SECOND",
+	intervalYear | intervalMonth: "YEAR TO MONTH",
+	intervalDay | intervalHour:   "DAY TO HOUR",
+	intervalDay | intervalHour | intervalMinute:                  "DAY TO MINUTE",
+	intervalDay | intervalHour | intervalMinute | intervalSecond: "DAY TO SECOND",
+	intervalHour | intervalMinute:                                "HOUR TO MINUTE",
+	intervalHour | intervalMinute | intervalSecond:               "HOUR TO SECOND",
+	intervalMinute | intervalSecond:                              "MINUTE TO SECOND",
+}
+
+// transformIntervalTypmods emits the fields and precision of an INTERVAL type.
+// The parser encodes them as a field bitmask followed by an optional precision.
+func (t *transformer) transformIntervalTypmods(w io.Writer, typmods []nodes.Node) error {
+	if len(typmods) == 0 {
+		return nil
+	}
+	if len(typmods) > 2 {
+		return fmt.Errorf("%d INTERVAL typmods, want 1 or 2", len(typmods))
 	}
-	if len(typeName.ArrayBounds.Items) > 0 {
-		if len(typeName.ArrayBounds.Items) > 1 {
-			return fmt.Errorf("%d items in TypeName array bounds, want 0 or 1", len(typeName.ArrayBounds.Items))
+	var vals []int64
+	for _, typmod := range typmods {
+		c, ok := typmod.(nodes.A_Const)
+		if !ok {
+			return fmt.Errorf("INTERVAL typmod is a %T, want A_Const", typmod)
 		}
-		ival, ok := typeName.ArrayBounds.Items[0].(nodes.Integer)
+		ival, ok := c.Val.(nodes.Integer)
 		if !ok {
-			return fmt.Errorf("TypeName array bounds item is a %T, want Integer", typeName.ArrayBounds.Items[0])
+			return fmt.Errorf("INTERVAL typmod is a %T, want Integer", c.Val)
 		}
-		if ival.Ival != -1 {
-			return fmt.Errorf("TypeName array bounds is %d, want -1", ival.Ival)
+		vals = append(vals, ival.Ival)
+	}
+	if vals[0] == intervalFullRange {
+		if len(vals) > 1 {
+			fmt.Fprintf(w, "(%d)", vals[1])
 		}
-		fmt.Fprint(w, "[]")
+		return nil
+	}
+	fields, ok := intervalFields[vals[0]]
+	if !ok {
+		return fmt.Errorf("unknown INTERVAL fields %#x", vals[0])
+	}
+	fmt.Fprint(w, " ", fields)
+	if len(vals) > 1 {
+		// Only fields ending in SECOND take a precision.
+		fmt.Fprintf(w, "(%d)", vals[1])
 	}
 	return nil
 }
@@ -1142,11 +2690,22 @@ func (t *transformer) addTenantID(w io.Writer) {
 	t.isTransformed = true
 }
 
+// safestr returns s as an SQL identifier,
+// quoted if it is a keyword or would otherwise not round-trip through the parser
+// (which folds unquoted identifiers to lower case).
+// This follows quote_identifier in Postgres's ruleutils.c.
 func safestr(s string) string {
-	switch s {
-	case "position", "timestamp", "type":
+	if s == "" || quotedKeywords[s] {
 		return pq.QuoteIdentifier(s)
 	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c == '_':
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return pq.QuoteIdentifier(s)
+		}
+	}
 	return s
 }
 
@@ -1163,17 +2722,6 @@ func commaSeparated(w io.Writer, nodelist []nodes.Node, env environ, f func(io.W
 	return nil
 }
 
-// maybeSetIsLeftJoinTable sets the status the main table that the query performs LEFT JOIN on to "isLeftJoinTable".
-// There can be only one table in env having "isLeftJoinTable" status.
-func maybeSetIsLeftJoinTable(env environ, table string) {
-	for _, status := range env {
-		if status == isLeftJoinTable {
-			return
-		}
-	}
-	env[table] = isLeftJoinTable
-}
-
 var paramRefType = reflect.TypeOf(nodes.ParamRef{})
 
 // findMaxParam uses reflection to walk the parse tree, ignoring
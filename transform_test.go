@@ -2,6 +2,7 @@ package pgtenant
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -11,6 +12,51 @@ func TestTransform(t *testing.T) {
 	TransformTester(t, "tenant_id", testQueries)
 }
 
+func TestTransformColumns(t *testing.T) {
+	DriverTransformTester(t, &Driver{
+		TenantIDCol: "tenant_id",
+		Whitelist:   testColumnsQueries,
+		Columns:     testColumns,
+	})
+}
+
+func TestTransformErrors(t *testing.T) {
+	cases := []struct {
+		q, want string
+	}{{
+		q:    "SELECT billing.forward.suit FROM log LEFT JOIN billing.forward USING (dollar)",
+		want: "cannot scope table billing.forward on this side of a join without an alias",
+	}, {
+		q:    "INSERT INTO log (coat, suit) SELECT f.*, 1 FROM log f",
+		want: "cannot expand * alongside other SELECT items",
+	}, {
+		q:    "INSERT INTO log VALUES ($1, $2)",
+		want: "no columns for table log in Driver.Columns",
+	}, {
+		q:    "INSERT INTO log (coat) VALUES ($1) ON CONFLICT ON CONSTRAINT log_coat_key DO NOTHING",
+		want: "ON CONFLICT ON CONSTRAINT log_coat_key not supported",
+	}, {
+		q:    "WITH log AS (SELECT suit, coat FROM forward) INSERT INTO billing.log SELECT * FROM log",
+		want: "cannot expand SELECT * from CTE log",
+	}}
+
+	conn := &Conn{
+		driver: &Driver{TenantIDCol: "tenant_id"},
+	}
+	for _, c := range cases {
+		t.Run(c.q, func(t *testing.T) {
+			ctx := WithQuery(context.Background(), c.q)
+			_, _, err := conn.transform(ctx, c.q)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if !strings.Contains(err.Error(), c.want) {
+				t.Errorf("got error %q, want one containing %q", err, c.want)
+			}
+		})
+	}
+}
+
 func TestEscape(t *testing.T) {
 	conn := &Conn{
 		driver: &Driver{TenantIDCol: "tenant_id"},
@@ -339,7 +385,7 @@ var testQueries = map[string]Transformed{
 	},
 	`SELECT score('proper-market', $1)`: {
 		`SELECT score('proper-market', $1)`,
-		1,
+		0,
 	},
 	`DELETE FROM shoulder WHERE hat < NOW() - interval '1 search'`: {
 		`DELETE FROM shoulder WHERE hat < NOW() - '1 search'::INTERVAL AND tenant_id = $1`,
@@ -454,11 +500,11 @@ var testQueries = map[string]Transformed{
 		12,
 	},
 	`WITH steel AS (SELECT dollar FROM nose) UPDATE throw SET noise = steel.dollar`: {
-		`WITH steel AS (SELECT dollar FROM nose WHERE tenant_id = $1) UPDATE throw SET noise = steel.dollar WHERE tenant_id = $1`,
+		`WITH steel AS (SELECT dollar FROM nose WHERE tenant_id = $1) UPDATE throw SET noise = steel.dollar WHERE throw.tenant_id = $1`,
 		1,
 	},
 	`WITH steel AS (SELECT dollar FROM nose), band AS (SELECT dollar FROM nose) UPDATE throw SET noise = steel.dollar`: {
-		`WITH steel AS (SELECT dollar FROM nose WHERE tenant_id = $1), band AS (SELECT dollar FROM nose WHERE tenant_id = $1) UPDATE throw SET noise = steel.dollar WHERE tenant_id = $1`,
+		`WITH steel AS (SELECT dollar FROM nose WHERE tenant_id = $1), band AS (SELECT dollar FROM nose WHERE tenant_id = $1) UPDATE throw SET noise = steel.dollar WHERE throw.tenant_id = $1`,
 		1,
 	},
 	`WITH valley AS ( INSERT INTO nose ("type", duck, dollar) SELECT depend."type", depend.duck, arrange('connect') FROM (SELECT "type", duck FROM throw WHERE noise IS NULL GROUP BY 1, 2) AS depend ON CONFLICT DO NOTHING RETURNING dollar, "type", duck ) UPDATE throw depend SET noise = tube.dollar FROM valley tube WHERE (depend."type", depend.duck) = (tube."type", tube.duck) AND depend.noise IS NULL`: {
@@ -481,4 +527,490 @@ var testQueries = map[string]Transformed{
 		`SELECT (famous.drink)::text, famous.total, famous.coat, famous.suit, fresh.suit AS seat, spot.suit AS shoe FROM plural famous LEFT JOIN forward spot ON spot.dollar = famous.total AND spot.tenant_id = $4 LEFT JOIN log fresh ON fresh.coat = famous.coat AND fresh.tenant_id = $4 WHERE drink > 0 AND famous.suit @> gray('event', '2018-10-23T02:00:00Z') AND (famous.total, famous.coat, famous.suit) > ($1, $2, $3::jsonb) AND famous.tenant_id = $4 ORDER BY famous.total ASC, famous.coat ASC, famous.suit ASC LIMIT 50`,
 		4,
 	},
+	`SELECT dollar FROM throw UNION ALL SELECT dollar FROM spend WHERE term = $1 ORDER BY dollar LIMIT 10`: {
+		`SELECT dollar FROM throw WHERE tenant_id = $2 UNION ALL SELECT dollar FROM spend WHERE term = $1 AND tenant_id = $2 ORDER BY dollar LIMIT 10`,
+		2,
+	},
+	`(SELECT nine FROM subtract ORDER BY offer DESC LIMIT 1) UNION SELECT nine FROM skill INTERSECT SELECT nine FROM station`: {
+		`(SELECT nine FROM subtract WHERE tenant_id = $1 ORDER BY offer DESC LIMIT 1) UNION (SELECT nine FROM skill WHERE tenant_id = $1 INTERSECT SELECT nine FROM station WHERE tenant_id = $1)`,
+		1,
+	},
+	`WITH nor AS (SELECT dollar FROM nose) SELECT dollar FROM nor EXCEPT SELECT dollar FROM throw`: {
+		`WITH nor AS (SELECT dollar FROM nose WHERE tenant_id = $1) SELECT dollar FROM nor EXCEPT SELECT dollar FROM throw WHERE throw.tenant_id = $1`,
+		1,
+	},
+	`INSERT INTO wife (suffix, favor) SELECT suffix, favor FROM stream UNION SELECT $1, $2`: {
+		`INSERT INTO wife (suffix, favor, tenant_id) SELECT suffix, favor, $3 FROM stream WHERE tenant_id = $3 UNION SELECT $1, $2, $3`,
+		3,
+	},
+	`SELECT DISTINCT "type", duck FROM nose WHERE shop IS NULL ORDER BY duck`: {
+		`SELECT DISTINCT "type", duck FROM nose WHERE shop IS NULL AND tenant_id = $1 ORDER BY duck`,
+		1,
+	},
+	`SELECT DISTINCT ON (total, coat) total, coat, suit FROM plural ORDER BY total, coat, born DESC`: {
+		`SELECT DISTINCT ON (total, coat) total, coat, suit FROM plural WHERE tenant_id = $1 ORDER BY total, coat, born DESC`,
+		1,
+	},
+	`SELECT count(*) FROM (SELECT DISTINCT * FROM plural) AS famous`: {
+		`SELECT count(*) FROM (SELECT DISTINCT * FROM plural WHERE tenant_id = $1) AS famous`,
+		1,
+	},
+	`SELECT dollar, "type" FROM nose WHERE duck = $1 ORDER BY dollar LIMIT $2 OFFSET $3`: {
+		`SELECT dollar, "type" FROM nose WHERE duck = $1 AND tenant_id = $4 ORDER BY dollar LIMIT $2 OFFSET $3`,
+		4,
+	},
+	`SELECT dollar FROM nose ORDER BY dollar OFFSET $1 ROWS FETCH FIRST 20 ROWS ONLY`: {
+		`SELECT dollar FROM nose WHERE tenant_id = $2 ORDER BY dollar LIMIT 20 OFFSET $1`,
+		2,
+	},
+	`SELECT dollar FROM nose ORDER BY dollar LIMIT ALL OFFSET 10`: {
+		`SELECT dollar FROM nose WHERE tenant_id = $1 ORDER BY dollar LIMIT ALL OFFSET 10`,
+		1,
+	},
+	`(SELECT dollar FROM nose OFFSET 1) UNION ALL SELECT dollar FROM throw LIMIT $1`: {
+		`(SELECT dollar FROM nose WHERE tenant_id = $2 OFFSET 1) UNION ALL SELECT dollar FROM throw WHERE tenant_id = $2 LIMIT $1`,
+		2,
+	},
+	`SELECT dollar, suit FROM forward WHERE term = $1 ORDER BY dollar LIMIT 1 FOR UPDATE SKIP LOCKED`: {
+		`SELECT dollar, suit FROM forward WHERE term = $1 AND tenant_id = $2 ORDER BY dollar LIMIT 1 FOR UPDATE SKIP LOCKED`,
+		2,
+	},
+	`SELECT spot.dollar FROM forward spot INNER JOIN log fresh ON fresh.coat = spot.dollar FOR NO KEY UPDATE OF spot NOWAIT FOR KEY SHARE OF fresh`: {
+		`SELECT spot.dollar FROM forward spot INNER JOIN log fresh ON fresh.coat = spot.dollar AND fresh.tenant_id = $1 AND spot.tenant_id = $1 FOR NO KEY UPDATE OF spot NOWAIT FOR KEY SHARE OF fresh`,
+		1,
+	},
+	`SELECT dollar FROM forward FOR SHARE`: {
+		`SELECT dollar FROM forward WHERE tenant_id = $1 FOR SHARE`,
+		1,
+	},
+	`SELECT dollar, row_number() OVER (PARTITION BY "type" ORDER BY nature DESC) FROM spend WHERE populate = $1`: {
+		`SELECT dollar, row_number() OVER (PARTITION BY "type" ORDER BY nature DESC) FROM spend WHERE populate = $1 AND tenant_id = $2`,
+		2,
+	},
+	`SELECT total, sum(drink) OVER w, rank() OVER (w ORDER BY born), avg(drink) OVER (w ROWS BETWEEN $1 PRECEDING AND CURRENT ROW) FROM plural WINDOW w AS (PARTITION BY total, coat)`: {
+		`SELECT total, sum(drink) OVER w, rank() OVER (w ORDER BY born), avg(drink) OVER (w ROWS BETWEEN $1 PRECEDING AND CURRENT ROW) FROM plural WHERE tenant_id = $2 WINDOW w AS (PARTITION BY total, coat)`,
+		2,
+	},
+	`SELECT sum(drink) OVER (ORDER BY born RANGE UNBOUNDED PRECEDING), max(drink) OVER (ORDER BY born ROWS BETWEEN 1 FOLLOWING AND UNBOUNDED FOLLOWING), min(drink) OVER () FROM plural`: {
+		`SELECT sum(drink) OVER (ORDER BY born RANGE UNBOUNDED PRECEDING), max(drink) OVER (ORDER BY born ROWS BETWEEN 1 FOLLOWING AND UNBOUNDED FOLLOWING), min(drink) OVER () FROM plural WHERE tenant_id = $1`,
+		1,
+	},
+	`SELECT count(DISTINCT slave) FILTER (WHERE populate = $1), string_agg(dollar, ',' ORDER BY dollar DESC) FROM spend`: {
+		`SELECT count(DISTINCT slave) FILTER (WHERE populate = $1), string_agg(dollar, ',' ORDER BY dollar DESC) FROM spend WHERE tenant_id = $2`,
+		2,
+	},
+	`SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY drink), count(*) FILTER (WHERE drink > 0) OVER (PARTITION BY total) FROM plural`: {
+		`SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY drink), count(*) FILTER (WHERE drink > 0) OVER (PARTITION BY total) FROM plural WHERE tenant_id = $1`,
+		1,
+	},
+	`SELECT concat_ws(',', VARIADIC $1::text[])`: {
+		`SELECT concat_ws(',', VARIADIC $1::text[])`,
+		0,
+	},
+	`SELECT dollar FROM nose WHERE "type" IN ('a', $1) AND duck NOT IN (1, 2, 3)`: {
+		`SELECT dollar FROM nose WHERE "type" IN ('a', $1) AND duck NOT IN (1, 2, 3) AND tenant_id = $2`,
+		2,
+	},
+	`SELECT dollar FROM nose WHERE dollar LIKE $1 OR dollar NOT ILIKE $2 OR "type" LIKE 'a!%%' ESCAPE '!'`: {
+		`SELECT dollar FROM nose WHERE (dollar LIKE $1 OR dollar NOT ILIKE $2 OR "type" LIKE 'a!%%' ESCAPE '!') AND tenant_id = $3`,
+		3,
+	},
+	`SELECT dollar FROM nose WHERE dollar SIMILAR TO '(a|b)%' AND "type" NOT SIMILAR TO $1 ESCAPE '#'`: {
+		`SELECT dollar FROM nose WHERE dollar SIMILAR TO '(a|b)%' AND "type" NOT SIMILAR TO $1 ESCAPE '#' AND tenant_id = $2`,
+		2,
+	},
+	`DELETE FROM stretch WHERE dream BETWEEN $1 AND $2 OR pitch NOT BETWEEN SYMMETRIC 10 AND 1`: {
+		`DELETE FROM stretch WHERE (dream BETWEEN $1 AND $2 OR pitch NOT BETWEEN SYMMETRIC 10 AND 1) AND tenant_id = $3`,
+		3,
+	},
+	`SELECT total FROM stretch WHERE pitch BETWEEN SYMMETRIC $1 AND $2 AND chick NOT BETWEEN 0 AND 1`: {
+		`SELECT total FROM stretch WHERE pitch BETWEEN SYMMETRIC $1 AND $2 AND chick NOT BETWEEN 0 AND 1 AND tenant_id = $3`,
+		3,
+	},
+	`INSERT INTO prepare (dollar, suit) VALUES ($1, $2) ON CONFLICT (dollar) DO UPDATE SET suit = $2 WHERE prepare.suit IS DISTINCT FROM $2`: {
+		`INSERT INTO prepare (dollar, suit, tenant_id) VALUES ($1, $2, $3) ON CONFLICT (dollar, tenant_id) DO UPDATE SET suit = $2 WHERE prepare.suit IS DISTINCT FROM $2 AND prepare.tenant_id = $3`,
+		3,
+	},
+	`SELECT dollar, shop IS NOT DISTINCT FROM $1 FROM nose WHERE duck > ALL($2::integer[])`: {
+		`SELECT dollar, shop IS NOT DISTINCT FROM $1 FROM nose WHERE duck > ALL($2::INT4[]) AND tenant_id = $3`,
+		3,
+	},
+	`SELECT chick IS NOT TRUE, chick IS FALSE FROM stretch WHERE chick IS UNKNOWN OR chick IS NOT FALSE OR chick IS TRUE OR chick IS NOT UNKNOWN`: {
+		`SELECT chick IS NOT TRUE, chick IS FALSE FROM stretch WHERE (chick IS UNKNOWN OR chick IS NOT FALSE OR chick IS TRUE OR chick IS NOT UNKNOWN) AND tenant_id = $1`,
+		1,
+	},
+	`SELECT dollar, (SELECT count(*) FROM throw WHERE throw.noise = nose.dollar) AS n, ARRAY(SELECT term FROM spend WHERE spend.dollar = nose.dollar) FROM nose`: {
+		`SELECT dollar, (SELECT count(*) FROM throw WHERE throw.noise = nose.dollar AND tenant_id = $1) AS n, ARRAY(SELECT term FROM spend WHERE spend.dollar = nose.dollar AND tenant_id = $1) FROM nose WHERE tenant_id = $1`,
+		1,
+	},
+	`SELECT total FROM stretch WHERE pitch > ALL (SELECT drink FROM cotton WHERE swim = $1) AND dream < ANY (SELECT feed FROM necessary)`: {
+		`SELECT total FROM stretch WHERE pitch > ALL (SELECT drink FROM cotton WHERE swim = $1 AND tenant_id = $2) AND dream < ANY (SELECT feed FROM necessary WHERE tenant_id = $2) AND tenant_id = $2`,
+		2,
+	},
+	`SELECT total FROM stretch WHERE (total, pitch) = ANY (SELECT coat, drink FROM cotton) AND double NOT IN (SELECT apple FROM cotton)`: {
+		`SELECT total FROM stretch WHERE (total, pitch) = ANY (SELECT coat, drink FROM cotton WHERE tenant_id = $1) AND (NOT double IN (SELECT apple FROM cotton WHERE tenant_id = $1)) AND tenant_id = $1`,
+		1,
+	},
+	`SELECT total FROM stretch WHERE (total, pitch) > (SELECT coat, drink FROM cotton LIMIT 1)`: {
+		`SELECT total FROM stretch WHERE (total, pitch) > (SELECT coat, drink FROM cotton WHERE tenant_id = $1 LIMIT 1) AND tenant_id = $1`,
+		1,
+	},
+	`SELECT spot.suit, fresh.suit FROM log fresh RIGHT JOIN forward spot ON spot.dollar = fresh.coat WHERE spot.term = $1`: {
+		`SELECT spot.suit, fresh.suit FROM log fresh RIGHT JOIN forward spot ON spot.dollar = fresh.coat AND fresh.tenant_id = $2 WHERE spot.term = $1 AND spot.tenant_id = $2`,
+		2,
+	},
+	`SELECT spot.suit, fresh.suit FROM forward spot FULL JOIN log fresh ON spot.dollar = fresh.coat`: {
+		`SELECT spot.suit, fresh.suit FROM (SELECT * FROM forward WHERE tenant_id = $1) AS spot FULL JOIN (SELECT * FROM log WHERE tenant_id = $1) AS fresh ON spot.dollar = fresh.coat`,
+		1,
+	},
+	`SELECT nine, success FROM subtract CROSS JOIN necessary`: {
+		`SELECT nine, success FROM subtract CROSS JOIN necessary WHERE necessary.tenant_id = $1 AND subtract.tenant_id = $1`,
+		1,
+	},
+	`SELECT dollar, suit FROM forward INNER JOIN prepare USING (dollar) NATURAL LEFT JOIN wrong WHERE term = $1`: {
+		`SELECT dollar, suit FROM forward INNER JOIN prepare USING (dollar) NATURAL LEFT JOIN (SELECT * FROM wrong WHERE tenant_id = $2) AS wrong WHERE term = $1 AND forward.tenant_id = $2 AND prepare.tenant_id = $2`,
+		2,
+	},
+	`SELECT j.dollar FROM (forward spot LEFT JOIN log fresh ON fresh.coat = spot.dollar) AS j`: {
+		`SELECT j.dollar FROM ((SELECT * FROM forward WHERE tenant_id = $1) AS spot LEFT JOIN log fresh ON fresh.coat = spot.dollar AND fresh.tenant_id = $1) AS j`,
+		1,
+	},
+	`SELECT meat.total FROM claim meat LEFT JOIN (forward spot INNER JOIN log fresh ON fresh.coat = spot.dollar) ON spot.dollar = meat.total`: {
+		`SELECT meat.total FROM claim meat LEFT JOIN (forward spot INNER JOIN log fresh ON fresh.coat = spot.dollar AND fresh.tenant_id = $1 AND spot.tenant_id = $1) ON spot.dollar = meat.total WHERE meat.tenant_id = $1`,
+		1,
+	},
+	`SELECT meat.total FROM claim meat LEFT JOIN forward spot ON spot.dollar = meat.total RIGHT JOIN log fresh ON fresh.coat = meat.coat`: {
+		`SELECT meat.total FROM claim meat LEFT JOIN forward spot ON spot.dollar = meat.total AND spot.tenant_id = $1 RIGHT JOIN log fresh ON fresh.coat = meat.coat AND meat.tenant_id = $1 WHERE fresh.tenant_id = $1`,
+		1,
+	},
+	`SELECT spot.dollar, latest.suit FROM forward spot INNER JOIN LATERAL (SELECT suit FROM log WHERE log.coat = spot.dollar ORDER BY evening DESC LIMIT 1) AS latest ON true`: {
+		`SELECT spot.dollar, latest.suit FROM forward spot INNER JOIN LATERAL (SELECT suit FROM log WHERE log.coat = spot.dollar AND log.tenant_id = $1 ORDER BY evening DESC LIMIT 1) AS latest ON true AND spot.tenant_id = $1`,
+		1,
+	},
+	`SELECT log.coat, e.value FROM log, LATERAL jsonb_array_elements(log.suit) WITH ORDINALITY AS e`: {
+		`SELECT log.coat, e.value FROM log, LATERAL jsonb_array_elements(log.suit) WITH ORDINALITY AS e WHERE tenant_id = $1`,
+		1,
+	},
+	`SELECT log.coat, fresh.suit FROM log LEFT JOIN LATERAL (SELECT suit FROM log fresh WHERE fresh.coat = log.coat LIMIT 1) AS fresh ON true`: {
+		`SELECT log.coat, fresh.suit FROM log LEFT JOIN LATERAL (SELECT suit FROM log fresh WHERE fresh.coat = log.coat AND fresh.tenant_id = $1 LIMIT 1) AS fresh ON true WHERE log.tenant_id = $1`,
+		1,
+	},
+	`SELECT billing.forward.suit FROM billing.forward WHERE billing.forward.term = $1`: {
+		`SELECT billing.forward.suit FROM billing.forward WHERE billing.forward.term = $1 AND tenant_id = $2`,
+		2,
+	},
+	`SELECT a.suit, b.suit FROM billing.forward a INNER JOIN archive.forward b ON a.dollar = b.dollar`: {
+		`SELECT a.suit, b.suit FROM billing.forward a INNER JOIN archive.forward b ON a.dollar = b.dollar AND a.tenant_id = $1 AND b.tenant_id = $1`,
+		1,
+	},
+	`SELECT billing.forward.suit, archive.forward.suit FROM billing.forward, archive.forward WHERE billing.forward.dollar = archive.forward.dollar`: {
+		`SELECT billing.forward.suit, archive.forward.suit FROM billing.forward, archive.forward WHERE billing.forward.dollar = archive.forward.dollar AND archive.forward.tenant_id = $1 AND billing.forward.tenant_id = $1`,
+		1,
+	},
+	`INSERT INTO billing.forward (suit) VALUES ($1)`: {
+		`INSERT INTO billing.forward (suit, tenant_id) VALUES ($1, $2)`,
+		2,
+	},
+	`UPDATE billing.forward SET suit = $1 WHERE dollar = $2`: {
+		`UPDATE billing.forward SET suit = $1 WHERE dollar = $2 AND tenant_id = $3`,
+		3,
+	},
+	`DELETE FROM billing.forward WHERE dollar = $1`: {
+		`DELETE FROM billing.forward WHERE dollar = $1 AND tenant_id = $2`,
+		2,
+	},
+	`WITH forward AS (SELECT dollar FROM log) SELECT forward.dollar FROM forward, billing.forward f WHERE f.dollar = forward.dollar`: {
+		`WITH forward AS (SELECT dollar FROM log WHERE tenant_id = $1) SELECT forward.dollar FROM forward, billing.forward f WHERE f.dollar = forward.dollar AND f.tenant_id = $1`,
+		1,
+	},
+	`SELECT CASE suit WHEN 'hearts' THEN 1 WHEN 'spades' THEN 2 ELSE 0 END FROM log`: {
+		`SELECT CASE suit WHEN 'hearts' THEN 1 WHEN 'spades' THEN 2 ELSE 0 END FROM log WHERE tenant_id = $1`,
+		1,
+	},
+	`SELECT CASE WHEN coat > $1 THEN 'big' WHEN coat > $2 THEN 'medium' END AS size FROM log`: {
+		`SELECT CASE WHEN coat > $1 THEN 'big' WHEN coat > $2 THEN 'medium' END AS size FROM log WHERE tenant_id = $3`,
+		3,
+	},
+	`SELECT CASE coat + 1 WHEN (SELECT dollar FROM forward LIMIT 1) THEN suit END FROM log`: {
+		`SELECT CASE coat + 1 WHEN (SELECT dollar FROM forward WHERE tenant_id = $1 LIMIT 1) THEN suit END FROM log WHERE tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE evening >= CURRENT_DATE - 7 AND evening < CURRENT_DATE`: {
+		`SELECT suit FROM log WHERE evening >= CURRENT_DATE - 7 AND evening < CURRENT_DATE AND tenant_id = $1`,
+		1,
+	},
+	`INSERT INTO log (coat, evening, suit) VALUES ($1, LOCALTIMESTAMP(3), CURRENT_USER)`: {
+		`INSERT INTO log (coat, evening, suit, tenant_id) VALUES ($1, LOCALTIMESTAMP(3), CURRENT_USER, $2)`,
+		2,
+	},
+	`SELECT CURRENT_TIME, CURRENT_TIME(2), CURRENT_TIMESTAMP(0), LOCALTIME, SESSION_USER, CURRENT_SCHEMA FROM log`: {
+		`SELECT CURRENT_TIME, CURRENT_TIME(2), CURRENT_TIMESTAMP(0), LOCALTIME, SESSION_USER, CURRENT_SCHEMA FROM log WHERE tenant_id = $1`,
+		1,
+	},
+	`INSERT INTO forward (dollar, suit, bread) VALUES ($1::varchar(64), $2::numeric(12,2), $3::myschema.mood)`: {
+		`INSERT INTO forward (dollar, suit, bread, tenant_id) VALUES ($1::VARCHAR(64), $2::NUMERIC(12, 2), $3::myschema.mood, $4)`,
+		4,
+	},
+	`SELECT suit FROM log WHERE evening > DATE '2020-01-01' AND evening < $1::timestamp(3) with time zone`: {
+		`SELECT suit FROM log WHERE evening > '2020-01-01'::date AND evening < $1::TIMESTAMP(3) WITH TIME ZONE AND tenant_id = $2`,
+		2,
+	},
+	`SELECT suit FROM log WHERE evening > NOW() - INTERVAL '3' DAY AND evening < NOW() - $1::interval day to second(3) AND coat <> $2::interval(2)`: {
+		`SELECT suit FROM log WHERE evening > NOW() - '3'::INTERVAL DAY AND evening < NOW() - $1::INTERVAL DAY TO SECOND(3) AND coat <> $2::INTERVAL(2) AND tenant_id = $3`,
+		3,
+	},
+	`SELECT suit FROM log WHERE coat = ANY($1::int[][]) OR bread = ANY($2::text[3])`: {
+		`SELECT suit FROM log WHERE (coat = ANY($1::INT4[][]) OR bread = ANY($2::text[3])) AND tenant_id = $3`,
+		3,
+	},
+	`SELECT "user", "order", "group", "createdAt" FROM "Accounts" WHERE "Accounts"."createdAt" > $1`: {
+		`SELECT "user", "order", "group", "createdAt" FROM "Accounts" WHERE "Accounts"."createdAt" > $1 AND tenant_id = $2`,
+		2,
+	},
+	`SELECT "select".dollar FROM forward AS "select" INNER JOIN "Log" ON "Log".coat = "select".dollar`: {
+		`SELECT "select".dollar FROM forward "select" INNER JOIN "Log" ON "Log".coat = "select".dollar AND "Log".tenant_id = $1 AND "select".tenant_id = $1`,
+		1,
+	},
+	`WITH "Recent" AS (SELECT "left", "right" FROM log) SELECT "left" FROM "Recent"`: {
+		`WITH "Recent" AS (SELECT "left", "right" FROM log WHERE tenant_id = $1) SELECT "left" FROM "Recent"`,
+		1,
+	},
+	`INSERT INTO "Billing"."Log" ("user", suit) VALUES ($1, $2)`: {
+		`INSERT INTO "Billing"."Log" ("user", suit, tenant_id) VALUES ($1, $2, $3)`,
+		3,
+	},
+	`SELECT suit FROM log WHERE path = E'C:\\temp\\it''s' OR path LIKE 'a\%'`: {
+		`SELECT suit FROM log WHERE (path = E'C:\\temp\\it''s' OR path LIKE E'a\\%') AND tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE mask & B'1010' = B'1000' AND flags = X'fF'`: {
+		`SELECT suit FROM log WHERE mask & B'1010' = B'1000' AND flags = X'fF' AND tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE coat > 123456789012345678901234567890 AND bread < -9223372036854775808 AND pitch = 1.5e-300 AND (-1)::text = $1`: {
+		`SELECT suit FROM log WHERE coat > 123456789012345678901234567890 AND bread < -9223372036854775808 AND pitch = 1.5e-300 AND (-1)::text = $1 AND tenant_id = $2`,
+		2,
+	},
+	`UPDATE log SET chick = true, fat = false WHERE chick IS NOT TRUE`: {
+		`UPDATE log SET chick = true, fat = false WHERE chick IS NOT TRUE AND tenant_id = $1`,
+		1,
+	},
+	`INSERT INTO log (coat, suit) VALUES ($1, $2), ($3, DEFAULT), (4, 'five') ON CONFLICT (coat) DO NOTHING`: {
+		`INSERT INTO log (coat, suit, tenant_id) VALUES ($1, $2, $4), ($3, DEFAULT, $4), (4, 'five', $4) ON CONFLICT (coat, tenant_id) DO NOTHING`,
+		4,
+	},
+	`INSERT INTO log DEFAULT VALUES RETURNING coat`: {
+		`INSERT INTO log (tenant_id) VALUES ($1) RETURNING coat`,
+		1,
+	},
+	`UPDATE log SET suit = $1 RETURNING coat`: {
+		`UPDATE log SET suit = $1 WHERE tenant_id = $2 RETURNING coat`,
+		2,
+	},
+	`UPDATE log SET suit = f.suit FROM forward f`: {
+		`UPDATE log SET suit = f.suit FROM forward f WHERE f.tenant_id = $1 AND log.tenant_id = $1`,
+		1,
+	},
+	`UPDATE ONLY log AS l SET suit = f.suit FROM forward f WHERE f.dollar = l.coat RETURNING l.coat, f.dollar`: {
+		`UPDATE ONLY log l SET suit = f.suit FROM forward f WHERE f.dollar = l.coat AND f.tenant_id = $1 AND l.tenant_id = $1 RETURNING l.coat, f.dollar`,
+		1,
+	},
+	`SELECT suit FROM ONLY log WHERE coat = $1`: {
+		`SELECT suit FROM ONLY log WHERE coat = $1 AND tenant_id = $2`,
+		2,
+	},
+	`WITH doomed AS (SELECT coat FROM log WHERE evening < $1) DELETE FROM forward WHERE dollar IN (SELECT coat FROM doomed) RETURNING dollar`: {
+		`WITH doomed AS (SELECT coat FROM log WHERE evening < $1 AND tenant_id = $2) DELETE FROM forward WHERE dollar IN (SELECT coat FROM doomed) AND forward.tenant_id = $2 RETURNING dollar`,
+		2,
+	},
+	`DELETE FROM ONLY log l USING forward f WHERE f.dollar = l.coat AND f.suit = $1 RETURNING l.coat`: {
+		`DELETE FROM ONLY log l USING forward f WHERE f.dollar = l.coat AND f.suit = $1 AND f.tenant_id = $2 AND l.tenant_id = $2 RETURNING l.coat`,
+		2,
+	},
+	`DELETE FROM log USING forward, prepare WHERE forward.dollar = log.coat AND prepare.dollar = log.coat`: {
+		`DELETE FROM log USING forward, prepare WHERE forward.dollar = log.coat AND prepare.dollar = log.coat AND forward.tenant_id = $1 AND log.tenant_id = $1 AND prepare.tenant_id = $1`,
+		1,
+	},
+	`UPDATE log SET (suit, evening) = ($1, DEFAULT), coat = $2 WHERE coat = $3`: {
+		`UPDATE log SET (suit, evening) = ($1, DEFAULT), coat = $2 WHERE coat = $3 AND tenant_id = $4`,
+		4,
+	},
+	`UPDATE log SET (suit, evening) = (SELECT f.suit, f.evening FROM forward f WHERE f.dollar = log.coat) WHERE coat = $1`: {
+		`UPDATE log SET (suit, evening) = (SELECT f.suit, f.evening FROM forward f WHERE f.dollar = log.coat AND tenant_id = $2) WHERE coat = $1 AND tenant_id = $2`,
+		2,
+	},
+	`INSERT INTO log (coat, suit) VALUES ($1, $2) ON CONFLICT (coat) DO UPDATE SET (suit, evening) = (excluded.suit, NOW())`: {
+		`INSERT INTO log (coat, suit, tenant_id) VALUES ($1, $2, $3) ON CONFLICT (coat, tenant_id) DO UPDATE SET (suit, evening) = (excluded.suit, NOW())`,
+		3,
+	},
+	`INSERT INTO log (coat, suit) VALUES ($1, $2) ON CONFLICT (lower(suit), (coat || 'x') COLLATE "C" text_pattern_ops) DO NOTHING`: {
+		`INSERT INTO log (coat, suit, tenant_id) VALUES ($1, $2, $3) ON CONFLICT (lower(suit), (coat || 'x') COLLATE "C" text_pattern_ops, tenant_id) DO NOTHING`,
+		3,
+	},
+	`INSERT INTO log (coat, suit) VALUES ($1, $2) ON CONFLICT (coat) WHERE evening IS NULL DO UPDATE SET suit = excluded.suit WHERE log.suit <> excluded.suit`: {
+		`INSERT INTO log (coat, suit, tenant_id) VALUES ($1, $2, $3) ON CONFLICT (coat, tenant_id) WHERE evening IS NULL DO UPDATE SET suit = excluded.suit WHERE log.suit <> excluded.suit AND log.tenant_id = $3`,
+		3,
+	},
+	`WITH touched AS (UPDATE log SET suit = $1 WHERE coat = $2 RETURNING coat) SELECT f.suit FROM forward f, touched WHERE f.dollar = touched.coat`: {
+		`WITH touched AS (UPDATE log SET suit = $1 WHERE coat = $2 AND tenant_id = $3 RETURNING coat) SELECT f.suit FROM forward f, touched WHERE f.dollar = touched.coat AND f.tenant_id = $3`,
+		3,
+	},
+	`WITH doomed AS (DELETE FROM log WHERE evening < $1 RETURNING coat), gone AS (DELETE FROM forward USING doomed WHERE forward.dollar = doomed.coat RETURNING forward.dollar) SELECT count(*) FROM gone`: {
+		`WITH doomed AS (DELETE FROM log WHERE evening < $1 AND tenant_id = $2 RETURNING coat), gone AS (DELETE FROM forward USING doomed WHERE forward.dollar = doomed.coat AND forward.tenant_id = $2 RETURNING forward.dollar) SELECT count(*) FROM gone`,
+		2,
+	},
+	`WITH RECURSIVE chain AS (SELECT coat, suit FROM log WHERE coat = $1 UNION ALL SELECT l.coat, l.suit FROM log l, chain WHERE l.coat = chain.suit) SELECT coat FROM chain`: {
+		`WITH RECURSIVE chain AS (SELECT coat, suit FROM log WHERE coat = $1 AND tenant_id = $2 UNION ALL SELECT l.coat, l.suit FROM log l, chain WHERE l.coat = chain.suit AND l.tenant_id = $2) SELECT coat FROM chain`,
+		2,
+	},
+	`WITH RECURSIVE depth(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM depth WHERE n < $1) SELECT suit, n FROM log, depth`: {
+		`WITH RECURSIVE depth(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM depth WHERE n < $1) SELECT suit, n FROM log, depth WHERE log.tenant_id = $2`,
+		2,
+	},
+	`SELECT 1 FROM forward FULL JOIN log ON log.coat = forward.dollar, forward c`: {
+		`SELECT 1 FROM (SELECT * FROM forward WHERE tenant_id = $1) AS forward FULL JOIN (SELECT * FROM log WHERE tenant_id = $1) AS log ON log.coat = forward.dollar, forward c WHERE c.tenant_id = $1`,
+		1,
+	},
+	`SELECT 1 FROM forward FULL JOIN log ON log.coat = forward.dollar JOIN forward c USING (dollar)`: {
+		`SELECT 1 FROM (SELECT * FROM forward WHERE tenant_id = $1) AS forward FULL JOIN (SELECT * FROM log WHERE tenant_id = $1) AS log ON log.coat = forward.dollar INNER JOIN forward c USING (dollar) WHERE c.tenant_id = $1`,
+		1,
+	},
+	`SELECT 1 FROM forward JOIN log ON log.coat = forward.dollar RIGHT JOIN forward c ON c.dollar = log.coat`: {
+		`SELECT 1 FROM forward INNER JOIN log ON log.coat = forward.dollar AND forward.tenant_id = $1 AND log.tenant_id = $1 RIGHT JOIN forward c ON c.dollar = log.coat WHERE c.tenant_id = $1`,
+		1,
+	},
+	`SELECT f.suit FROM log LEFT JOIN billing.forward f ON f.dollar = log.coat`: {
+		`SELECT f.suit FROM log LEFT JOIN billing.forward f ON f.dollar = log.coat AND f.tenant_id = $1 WHERE log.tenant_id = $1`,
+		1,
+	},
+	`SELECT a.suit FROM billing.forward a FULL JOIN archive.forward b USING (dollar)`: {
+		`SELECT a.suit FROM (SELECT * FROM billing.forward WHERE tenant_id = $1) AS a FULL JOIN (SELECT * FROM archive.forward WHERE tenant_id = $1) AS b USING (dollar)`,
+		1,
+	},
+	`SELECT suit FROM billing.forward WHERE dollar = $1 FOR UPDATE OF forward`: {
+		`SELECT suit FROM billing.forward WHERE dollar = $1 AND tenant_id = $2 FOR UPDATE OF forward`,
+		2,
+	},
+	`DELETE FROM log WHERE coat = $1 RETURNING coat AS gone, suit`: {
+		`DELETE FROM log WHERE coat = $1 AND tenant_id = $2 RETURNING coat AS gone, suit`,
+		2,
+	},
+	`UPDATE log SET suit = $1 WHERE coat = $2 RETURNING coat AS changed`: {
+		`UPDATE log SET suit = $1 WHERE coat = $2 AND tenant_id = $3 RETURNING coat AS changed`,
+		3,
+	},
+	`INSERT INTO log (coat) VALUES ($1) RETURNING coat AS added, evening`: {
+		`INSERT INTO log (coat, tenant_id) VALUES ($1, $2) RETURNING coat AS added, evening`,
+		2,
+	},
+	`SELECT string_agg(suit, ',' ORDER BY suit NULLS FIRST), percentile_cont(0.5) WITHIN GROUP (ORDER BY coat DESC NULLS LAST) FROM log`: {
+		`SELECT string_agg(suit, ',' ORDER BY suit NULLS FIRST), percentile_cont(0.5) WITHIN GROUP (ORDER BY coat DESC NULLS LAST) FROM log WHERE tenant_id = $1`,
+		1,
+	},
+	`SELECT coat, rank() OVER (ORDER BY evening DESC NULLS LAST) FROM log ORDER BY coat USING >, suit USING OPERATOR(pg_catalog.<) NULLS FIRST`: {
+		`SELECT coat, rank() OVER (ORDER BY evening DESC NULLS LAST) FROM log WHERE tenant_id = $1 ORDER BY coat USING >, suit USING OPERATOR(pg_catalog.<) NULLS FIRST`,
+		1,
+	},
+	`SELECT "MyFunc"(suit), left(suit, 2) FROM log WHERE coat = $1::"MyType" AND bread = $2::"char"`: {
+		`SELECT "MyFunc"(suit), "left"(suit, 2) FROM log WHERE coat = $1::"MyType" AND bread = $2::"char" AND tenant_id = $3`,
+		3,
+	},
+	`SELECT j.q FROM (forward spot INNER JOIN log fresh ON fresh.coat = spot.dollar) AS j(q, r)`: {
+		`SELECT j.q FROM (forward spot INNER JOIN log fresh ON fresh.coat = spot.dollar AND fresh.tenant_id = $1 AND spot.tenant_id = $1) AS j(q, r)`,
+		1,
+	},
+	`SELECT s.m FROM (SELECT coat, suit FROM log) AS s(m, n)`: {
+		`SELECT s.m FROM (SELECT coat, suit FROM log WHERE tenant_id = $1) AS s(m, n)`,
+		1,
+	},
+	`SELECT suit FROM log WHERE evening < ALL(ARRAY[$1, $2]) AND coat = ANY(ARRAY['a', 'b'])`: {
+		`SELECT suit FROM log WHERE evening < ALL(ARRAY[$1, $2]) AND coat = ANY(ARRAY['a', 'b']) AND tenant_id = $3`,
+		3,
+	},
+	`SELECT suit FROM log WHERE (chick OR fat) IS NOT TRUE`: {
+		`SELECT suit FROM log WHERE (chick OR fat) IS NOT TRUE AND tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE (chick AND fat) IS NOT TRUE OR NOT (chick OR fat) IS TRUE`: {
+		`SELECT suit FROM log WHERE ((chick AND fat) IS NOT TRUE OR (NOT (chick OR fat) IS TRUE)) AND tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE (chick OR fat) IS DISTINCT FROM true`: {
+		`SELECT suit FROM log WHERE (chick OR fat) IS DISTINCT FROM true AND tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE (coat IS DISTINCT FROM suit) = chick`: {
+		`SELECT suit FROM log WHERE (coat IS DISTINCT FROM suit) = chick AND tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE (chick OR fat) IN (true)`: {
+		`SELECT suit FROM log WHERE (chick OR fat) IN (true) AND tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE (suit LIKE 'a%') = chick`: {
+		`SELECT suit FROM log WHERE (suit LIKE 'a%') = chick AND tenant_id = $1`,
+		1,
+	},
+	`SELECT suit FROM log WHERE (coat = suit) BETWEEN chick AND (chick OR fat)`: {
+		`SELECT suit FROM log WHERE (coat = suit) BETWEEN chick AND (chick OR fat) AND tenant_id = $1`,
+		1,
+	},
+	`SELECT log.suit, s.suit FROM log FULL JOIN forward AS s(suit, dollar) ON s.dollar = log.coat`: {
+		`SELECT log.suit, s.suit FROM (SELECT * FROM log WHERE tenant_id = $1) AS log FULL JOIN (SELECT * FROM forward WHERE tenant_id = $1) AS s(suit, dollar) ON s.dollar = log.coat`,
+		1,
+	},
+	`SELECT l2.suit FROM (SELECT dollar FROM forward) AS log, log l2 WHERE l2.coat = log.dollar`: {
+		`SELECT l2.suit FROM (SELECT dollar FROM forward WHERE tenant_id = $1) AS log, log l2 WHERE l2.coat = log.dollar AND l2.tenant_id = $1`,
+		1,
+	},
+	`WITH a AS (SELECT dollar FROM (SELECT dollar FROM forward) AS log) SELECT log.suit FROM a, log`: {
+		`WITH a AS (SELECT dollar FROM (SELECT dollar FROM forward WHERE tenant_id = $1) AS log) SELECT log.suit FROM a, log WHERE log.tenant_id = $1`,
+		1,
+	},
+}
+
+// This describes the tables in testColumnsQueries.
+var testColumns = map[string][]string{
+	"log":         {"coat", "tenant_id", "suit", "evening"},
+	"billing.log": {"coat", "suit", "evening"},
+}
+
+// These are queries that need testColumns to be transformed.
+var testColumnsQueries = map[string]Transformed{
+	`INSERT INTO log VALUES ($1, $2, $3)`: {
+		`INSERT INTO log (coat, suit, evening, tenant_id) VALUES ($1, $2, $3, $4)`,
+		4,
+	},
+	`INSERT INTO log VALUES ($1), ($2) RETURNING suit`: {
+		`INSERT INTO log (coat, tenant_id) VALUES ($1, $3), ($2, $3) RETURNING suit`,
+		3,
+	},
+	`INSERT INTO billing.log SELECT dollar, suit FROM forward WHERE dollar = $1`: {
+		`INSERT INTO billing.log (coat, suit, tenant_id) SELECT dollar, suit, $2 FROM forward WHERE dollar = $1 AND tenant_id = $2`,
+		2,
+	},
+	`INSERT INTO billing.log SELECT * FROM log WHERE evening < $1`: {
+		`INSERT INTO billing.log (coat, suit, evening, tenant_id) SELECT coat, suit, evening, $2 FROM log WHERE evening < $1 AND tenant_id = $2`,
+		2,
+	},
+	`INSERT INTO log (coat, suit, evening) SELECT * FROM log l WHERE l.evening < $1 ON CONFLICT (coat) DO NOTHING`: {
+		`INSERT INTO log (coat, suit, evening, tenant_id) SELECT coat, suit, evening, $2 FROM log l WHERE l.evening < $1 AND tenant_id = $2 ON CONFLICT (coat, tenant_id) DO NOTHING`,
+		2,
+	},
+	`WITH moved(a, b) AS (DELETE FROM log WHERE evening < $1 RETURNING coat, suit) INSERT INTO billing.log SELECT * FROM moved`: {
+		`WITH moved(a, b) AS (DELETE FROM log WHERE evening < $1 AND tenant_id = $2 RETURNING coat, suit) INSERT INTO billing.log (coat, suit, tenant_id) SELECT a, b, $2 FROM moved`,
+		2,
+	},
+	`WITH moved(a) AS (DELETE FROM log WHERE evening < $1 RETURNING *) INSERT INTO billing.log SELECT * FROM moved`: {
+		`WITH moved(a) AS (DELETE FROM log WHERE evening < $1 AND tenant_id = $2 RETURNING *) INSERT INTO billing.log (coat, suit, evening, tenant_id) SELECT a, suit, evening, $2 FROM moved`,
+		2,
+	},
+	`WITH moved AS (DELETE FROM log WHERE evening < $1 RETURNING *) INSERT INTO billing.log SELECT * FROM moved`: {
+		`WITH moved AS (DELETE FROM log WHERE evening < $1 AND tenant_id = $2 RETURNING *) INSERT INTO billing.log (coat, suit, evening, tenant_id) SELECT coat, suit, evening, $2 FROM moved`,
+		2,
+	},
+	`INSERT INTO log SELECT l.* FROM log l WHERE l.evening < $1`: {
+		`INSERT INTO log (coat, suit, evening, tenant_id) SELECT l.coat, l.suit, l.evening, $2 FROM log l WHERE l.evening < $1 AND tenant_id = $2`,
+		2,
+	},
 }